@@ -9,8 +9,6 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/atclient"
-	"github.com/bluesky-social/indigo/atproto/atcrypto"
-	"github.com/bluesky-social/indigo/atproto/auth"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 
 	"github.com/urfave/cli/v3"
@@ -119,7 +117,7 @@ var cmdAccount = &cli.Command{
 				&cli.StringFlag{
 					Name:     "atproto-signing-key",
 					Required: true,
-					Usage:    "private key used to sign the token (multibase syntax)",
+					Usage:    "private key used to sign the token (multibase syntax, '@<keystore-name>', 'file:<path>', 'env:<name>', or 'exec:<command>')",
 					Sources:  cli.EnvVars("ATPROTO_SIGNING_KEY"),
 				},
 				&cli.StringFlag{
@@ -194,6 +192,7 @@ var cmdAccount = &cli.Command{
 			Action: runAccountCreate,
 		},
 		cmdAccountMigrate,
+		cmdAccountHandle,
 		cmdAccountPlc,
 	},
 }
@@ -212,7 +211,7 @@ func runAccountLogin(ctx context.Context, cmd *cli.Command) error {
 		if err != nil {
 			return err
 		}
-		dir := configDirectory(cmd.String("plc-host"))
+		dir := configDirectory(cmd)
 		client, err = atclient.LoginWithPassword(ctx, dir, username, cmd.String("password"), cmd.String("auth-factor-token"), authRefreshCallback)
 	}
 	if err != nil {
@@ -427,9 +426,9 @@ func runAccountServiceAuthOffline(ctx context.Context, cmd *cli.Command) error {
 	if privStr == "" {
 		return fmt.Errorf("private key must be provided")
 	}
-	privkey, err := atcrypto.ParsePrivateMultibase(privStr)
+	privkey, err := loadSigner(ctx, privStr)
 	if err != nil {
-		return fmt.Errorf("failed parsing private key: %w", err)
+		return err
 	}
 
 	issString := cmd.String("iss")
@@ -459,7 +458,7 @@ func runAccountServiceAuthOffline(ctx context.Context, cmd *cli.Command) error {
 	durSec := cmd.Int("duration-sec")
 	duration := time.Duration(durSec * int(time.Second))
 
-	token, err := auth.SignServiceAuth(iss, aud, duration, lxm, privkey)
+	token, err := signServiceAuthToken(iss, aud, duration, lxm, privkey)
 	if err != nil {
 		return fmt.Errorf("failed signing token: %w", err)
 	}
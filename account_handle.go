@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+var cmdAccountHandle = &cli.Command{
+	Name:  "handle",
+	Usage: "commands for managing account handle",
+	Commands: []*cli.Command{
+		&cli.Command{
+			Name:        "setup",
+			Usage:       "configure a domain name as handle for current account",
+			Description: "Prints DNS and HTTPS configuration for the domain, waits until the handle resolves to the current account, then updates the handle and confirms the change.",
+			ArgsUsage:   `<domain>`,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "interval",
+					Value: 10 * time.Second,
+					Usage: "time between resolution attempts",
+				},
+				&cli.DurationFlag{
+					Name:  "timeout",
+					Value: 30 * time.Minute,
+					Usage: "how long to wait for the handle to resolve",
+				},
+			},
+			Action: runAccountHandleSetup,
+		},
+	},
+}
+
+func runAccountHandleSetup(ctx context.Context, cmd *cli.Command) error {
+	raw := cmd.Args().First()
+	if raw == "" {
+		return fmt.Errorf("need to provide domain as argument")
+	}
+	handle, err := syntax.ParseHandle(raw)
+	if err != nil {
+		return err
+	}
+	handle = handle.Normalize()
+	if !handle.AllowedTLD() {
+		return fmt.Errorf("handle top-level domain is disallowed: %s", handle)
+	}
+
+	client, err := loadAuthClient(ctx, cmd)
+	if err == ErrNoAuthSession {
+		return fmt.Errorf("auth required, but not logged in")
+	} else if err != nil {
+		return err
+	}
+	if client.AccountDID == nil {
+		return fmt.Errorf("no account DID in auth session")
+	}
+	did := *client.AccountDID
+
+	fmt.Printf("To use %s as the handle for %s, configure either a DNS TXT record:\n", handle, did)
+	fmt.Println("")
+	fmt.Printf("    _atproto.%s\tTXT\t\"did=%s\"\n", handle, did)
+	fmt.Println("")
+	fmt.Println("or an HTTPS file, containing only the DID:")
+	fmt.Println("")
+	fmt.Printf("    https://%s/.well-known/atproto-did\n", handle)
+	fmt.Printf("    %s\n", did)
+	fmt.Println("")
+	fmt.Println("Note that DNS management interfaces commonly require only the sub-domain parts of a name, not the full registered domain.")
+	fmt.Println("")
+
+	bdir := configBaseDirectory(cmd)
+	interval := cmd.Duration("interval")
+	deadline := time.Now().Add(cmd.Duration("timeout"))
+	for {
+		dnsDID, dnsErr := bdir.ResolveHandleDNS(ctx, handle)
+		httpDID, httpErr := bdir.ResolveHandleWellKnown(ctx, handle)
+		if dnsErr == nil && dnsDID == did {
+			fmt.Println("handle verified via DNS")
+			break
+		}
+		if httpErr == nil && httpDID == did {
+			fmt.Println("handle verified via HTTPS")
+			break
+		}
+		fmt.Fprintf(os.Stderr, "waiting for handle to resolve... (DNS: %s; HTTPS: %s)\n", handleSetupStatus(dnsDID, dnsErr), handleSetupStatus(httpDID, httpErr))
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out waiting for handle to resolve")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	err = comatproto.IdentityUpdateHandle(ctx, client, &comatproto.IdentityUpdateHandle_Input{
+		Handle: handle.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating handle: %w", err)
+	}
+	fmt.Println("handle updated")
+
+	// flush any stale cached identity
+	dir := configDirectory(cmd)
+	dir.Purge(ctx, did.AtIdentifier())
+	dir.Purge(ctx, handle.AtIdentifier())
+
+	// confirm that DID document and PDS agree. the DID document may be updated asynchronously, so retry for a bit
+	const confirmAttempts = 5
+	var lastErr error
+	for i := range confirmAttempts {
+		lastErr = checkHandleUpdated(ctx, client, bdir, did, handle)
+		if lastErr == nil {
+			fmt.Println("DID document and PDS both report new handle")
+			return nil
+		}
+		if i == confirmAttempts-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return fmt.Errorf("handle updated, but could not confirm: %w", lastErr)
+}
+
+func handleSetupStatus(did syntax.DID, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("resolved to %s", did)
+}
+
+func checkHandleUpdated(ctx context.Context, client *atclient.APIClient, bdir *identity.BaseDirectory, did syntax.DID, handle syntax.Handle) error {
+	doc, err := bdir.ResolveDID(ctx, did)
+	if err != nil {
+		return err
+	}
+	ident := identity.ParseIdentity(doc)
+	decl, err := ident.DeclaredHandle()
+	if err != nil {
+		return err
+	}
+	if decl != handle {
+		return fmt.Errorf("DID document declares handle %s", decl)
+	}
+
+	sess, err := comatproto.ServerGetSession(ctx, client)
+	if err != nil {
+		return err
+	}
+	if sess.Handle != handle.String() {
+		return fmt.Errorf("PDS reports handle %s", sess.Handle)
+	}
+	return nil
+}
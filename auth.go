@@ -89,7 +89,7 @@ func loginOrLoadAuthClient(ctx context.Context, cmd *cli.Command) (*atclient.API
 	username := cmd.String("username")
 	password := cmd.String("password")
 	if username != "" && password != "" {
-		dir := configDirectory(cmd.String("plc-host"))
+		dir := configDirectory(cmd)
 		atid, err := syntax.ParseAtIdentifier(username)
 		if err != nil {
 			return nil, err
@@ -123,7 +123,7 @@ func loadAuthClient(ctx context.Context, cmd *cli.Command) (*atclient.APIClient,
 	}
 
 	// otherwise try new auth session using saved password
-	dir := configDirectory(cmd.String("plc-host"))
+	dir := configDirectory(cmd)
 	return atclient.LoginWithPassword(ctx, dir, sess.DID.AtIdentifier(), sess.Password, "", authRefreshCallback)
 }
 
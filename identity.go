@@ -21,11 +21,31 @@ var cmdResolve = &cli.Command{
 			Aliases: []string{"d"},
 			Usage:   "just resolve to DID",
 		},
+		&cli.BoolFlag{
+			Name:  "check",
+			Usage: "check each step of identity resolution and account hosting, and report problems",
+		},
+		&cli.StringFlag{
+			Name:  "batch",
+			Usage: "resolve many identifiers (one per line) from a file, or '-' for stdin; prints NDJSON",
+		},
+		&cli.IntFlag{
+			Name:  "workers",
+			Value: 8,
+			Usage: "number of concurrent lookups in batch mode",
+		},
+		&cli.BoolFlag{
+			Name:  "compare-methods",
+			Usage: "resolve handle with every method (DNS, authoritative DNS, HTTP), and print all results if they disagree",
+		},
 	},
 	Action: runResolve,
 }
 
 func runResolve(ctx context.Context, cmd *cli.Command) error {
+	if cmd.String("batch") != "" {
+		return runResolveBatch(ctx, cmd)
+	}
 	s := cmd.Args().First()
 	if s == "" {
 		return fmt.Errorf("need to provide account identifier as an argument")
@@ -35,10 +55,10 @@ func runResolve(ctx context.Context, cmd *cli.Command) error {
 	if err != nil {
 		return err
 	}
-	bdir := identity.BaseDirectory{
-		PLCURL:    cmd.String("plc-host"),
-		UserAgent: userAgentString(),
+	if cmd.Bool("check") {
+		return runIdentityCheck(ctx, cmd, atid)
 	}
+	bdir := configBaseDirectory(cmd)
 	var raw json.RawMessage
 
 	if atid.IsDID() {
@@ -59,7 +79,12 @@ func runResolve(ctx context.Context, cmd *cli.Command) error {
 		if err != nil {
 			return err
 		}
-		did, err := bdir.ResolveHandle(ctx, handle)
+		if cmd.Bool("compare-methods") {
+			if err := compareHandleMethods(ctx, bdir, handle); err != nil {
+				return err
+			}
+		}
+		did, err := resolveHandle(ctx, cmd, bdir, handle)
 		if err != nil {
 			return err
 		}
@@ -94,3 +119,40 @@ func runResolve(ctx context.Context, cmd *cli.Command) error {
 	fmt.Println(string(b))
 	return nil
 }
+
+// resolves a handle with each method separately. if the results are not all the same, prints them side by side and returns an error
+func compareHandleMethods(ctx context.Context, bdir *identity.BaseDirectory, handle syntax.Handle) error {
+	handle = handle.Normalize()
+	methods := []struct {
+		name    string
+		resolve func(context.Context, syntax.Handle) (syntax.DID, error)
+	}{
+		{"dns", bdir.ResolveHandleDNS},
+		{"dns-authoritative", bdir.ResolveHandleDNSAuthoritative},
+		{"http", bdir.ResolveHandleWellKnown},
+	}
+
+	// failures are compared as empty DIDs, so differing error messages don't count as disagreement
+	results := make([]string, len(methods))
+	dids := make([]syntax.DID, len(methods))
+	agree := true
+	for i, m := range methods {
+		did, err := m.resolve(ctx, handle)
+		if err != nil {
+			results[i] = fmt.Sprintf("error: %s", err)
+		} else {
+			results[i] = did.String()
+			dids[i] = did
+		}
+		if dids[i] != dids[0] {
+			agree = false
+		}
+	}
+	if agree {
+		return nil
+	}
+	for i, m := range methods {
+		fmt.Printf("%s\t%s\n", m.name, results[i])
+	}
+	return fmt.Errorf("handle resolution methods disagree")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+// one line of 'goat resolve --batch' output
+type batchResolveResult struct {
+	Input      string `json:"input"`
+	DID        string `json:"did,omitempty"`
+	Handle     string `json:"handle,omitempty"`
+	PDS        string `json:"pds,omitempty"`
+	SigningKey string `json:"signingKey,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func resolveBatchItem(ctx context.Context, dir identity.Directory, input string) batchResolveResult {
+	res := batchResolveResult{Input: input}
+	atid, err := syntax.ParseAtIdentifier(input)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	ident, err := dir.Lookup(ctx, atid)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.DID = ident.DID.String()
+	res.Handle = ident.Handle.String()
+	res.PDS = ident.PDSEndpoint()
+	pub, err := ident.PublicKey()
+	if err != nil {
+		res.Error = fmt.Sprintf("signing key: %s", err)
+	} else {
+		res.SigningKey = pub.DIDKey()
+	}
+	return res
+}
+
+// resolves identifiers (one per line) concurrently, and prints results as NDJSON, in the order they complete
+func runResolveBatch(ctx context.Context, cmd *cli.Command) error {
+	r, err := getFileOrStdin(cmd.String("batch"))
+	if err != nil {
+		return err
+	}
+	workers := int(cmd.Int("workers"))
+	if workers < 1 {
+		return fmt.Errorf("need at least one worker")
+	}
+
+	dir := configDirectory(cmd)
+	inputs := make(chan string)
+	results := make(chan batchResolveResult)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range inputs {
+				results <- resolveBatchItem(ctx, dir, s)
+			}
+		}()
+	}
+
+	var scanErr error
+	go func() {
+		defer close(inputs)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			s := strings.TrimSpace(scanner.Text())
+			if s == "" || strings.HasPrefix(s, "#") {
+				continue
+			}
+			inputs <- s
+		}
+		scanErr = scanner.Err()
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		b, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	}
+	return scanErr
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/adrg/xdg"
+	"github.com/urfave/cli/v3"
+)
+
+// how long persisted identity lookups are considered fresh
+const identityCacheTTL = time.Hour
+
+var cmdIdentity = &cli.Command{
+	Name:  "identity",
+	Usage: "sub-commands for identity resolution",
+	Commands: []*cli.Command{
+		&cli.Command{
+			Name:  "cache",
+			Usage: "manage the local persistent identity cache",
+			Commands: []*cli.Command{
+				&cli.Command{
+					Name:   "stats",
+					Usage:  "print identity cache location and entry counts",
+					Action: runIdentityCacheStats,
+				},
+				&cli.Command{
+					Name:      "purge",
+					Usage:     "delete cached identities (all, or specific identifiers)",
+					ArgsUsage: `<at-identifier>*`,
+					Action:    runIdentityCachePurge,
+				},
+			},
+		},
+	},
+}
+
+// Persists successful identity lookups as JSON files on local disk, so repeated goat invocations don't need to hit the network. Errors are never cached.
+//
+// Files are stored in two sub-directories: 'did/' holds the resolved identity (including the verified handle), and 'handle/' maps handles to DIDs.
+type DiskCacheDirectory struct {
+	Inner identity.Directory
+	Dir   string
+	TTL   time.Duration
+	// don't read cached entries (fresh lookups are still written). used when verifying signatures, so a recent signing key rotation is not missed
+	Refresh bool
+}
+
+var _ identity.Directory = (*DiskCacheDirectory)(nil)
+
+type diskCacheEntry struct {
+	DID       syntax.DID         `json:"did"`
+	Identity  *identity.Identity `json:"identity,omitempty"`
+	FetchedAt time.Time          `json:"fetchedAt"`
+}
+
+func identityCacheDir() (string, error) {
+	// xdg.CacheFile creates parent directories as needed
+	p, err := xdg.CacheFile("goat/identity/.keep")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(p), nil
+}
+
+func (d *DiskCacheDirectory) didPath(did syntax.DID) string {
+	// colons are not allowed in file names on some platforms
+	return filepath.Join(d.Dir, "did", strings.ReplaceAll(did.String(), ":", "_")+".json")
+}
+
+func (d *DiskCacheDirectory) handlePath(h syntax.Handle) string {
+	return filepath.Join(d.Dir, "handle", h.Normalize().String()+".json")
+}
+
+// returns nil if the entry is missing, stale, or can't be read
+func (d *DiskCacheDirectory) readEntry(p string) *diskCacheEntry {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+	var entry diskCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil
+	}
+	if time.Since(entry.FetchedAt) > d.TTL {
+		return nil
+	}
+	return &entry
+}
+
+// writes to a temporary file and renames, so concurrent readers never see partial files
+func (d *DiskCacheDirectory) writeEntry(p string, entry diskCacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (d *DiskCacheDirectory) store(ident *identity.Identity) {
+	now := time.Now()
+	// failures to write the cache are not fatal
+	_ = d.writeEntry(d.didPath(ident.DID), diskCacheEntry{DID: ident.DID, Identity: ident, FetchedAt: now})
+	if !ident.Handle.IsInvalidHandle() {
+		_ = d.writeEntry(d.handlePath(ident.Handle), diskCacheEntry{DID: ident.DID, FetchedAt: now})
+	}
+}
+
+func (d *DiskCacheDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	if !d.Refresh {
+		if entry := d.readEntry(d.didPath(did)); entry != nil && entry.Identity != nil && entry.Identity.DID == did {
+			return entry.Identity, nil
+		}
+	}
+	ident, err := d.Inner.LookupDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	d.store(ident)
+	return ident, nil
+}
+
+func (d *DiskCacheDirectory) LookupHandle(ctx context.Context, h syntax.Handle) (*identity.Identity, error) {
+	h = h.Normalize()
+	if entry := d.readEntry(d.handlePath(h)); entry != nil && !d.Refresh {
+		didEntry := d.readEntry(d.didPath(entry.DID))
+		if didEntry != nil && didEntry.Identity != nil && didEntry.Identity.Handle == h {
+			return didEntry.Identity, nil
+		}
+	}
+	ident, err := d.Inner.LookupHandle(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	d.store(ident)
+	return ident, nil
+}
+
+func (d *DiskCacheDirectory) Lookup(ctx context.Context, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	if atid.IsDID() {
+		did, _ := atid.AsDID()
+		return d.LookupDID(ctx, did)
+	}
+	handle, err := atid.AsHandle()
+	if err != nil {
+		return nil, err
+	}
+	return d.LookupHandle(ctx, handle)
+}
+
+func (d *DiskCacheDirectory) Purge(ctx context.Context, atid syntax.AtIdentifier) error {
+	if atid.IsDID() {
+		did, _ := atid.AsDID()
+		if entry := d.readEntry(d.didPath(did)); entry != nil && entry.Identity != nil && !entry.Identity.Handle.IsInvalidHandle() {
+			os.Remove(d.handlePath(entry.Identity.Handle))
+		}
+		os.Remove(d.didPath(did))
+	} else {
+		handle, err := atid.AsHandle()
+		if err != nil {
+			return err
+		}
+		os.Remove(d.handlePath(handle))
+	}
+	return d.Inner.Purge(ctx, atid)
+}
+
+func runIdentityCacheStats(ctx context.Context, cmd *cli.Command) error {
+	dir, err := identityCacheDir()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Location: %s\n", dir)
+	fmt.Printf("TTL: %s\n", identityCacheTTL)
+	for _, sub := range []string{"did", "handle"} {
+		var fresh, stale, size int64
+		err := filepath.WalkDir(filepath.Join(dir, sub), func(p string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if de.IsDir() || !strings.HasSuffix(p, ".json") {
+				return nil
+			}
+			info, err := de.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			if time.Since(info.ModTime()) > identityCacheTTL {
+				stale++
+			} else {
+				fresh++
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("Entries (%s): %d fresh, %d stale (%d bytes)\n", sub, fresh, stale, size)
+	}
+	return nil
+}
+
+func runIdentityCachePurge(ctx context.Context, cmd *cli.Command) error {
+	dir, err := identityCacheDir()
+	if err != nil {
+		return err
+	}
+	if cmd.Args().Len() == 0 {
+		for _, sub := range []string{"did", "handle"} {
+			if err := os.RemoveAll(filepath.Join(dir, sub)); err != nil {
+				return err
+			}
+		}
+		fmt.Println("identity cache purged")
+		return nil
+	}
+
+	dcd := DiskCacheDirectory{Inner: &identity.BaseDirectory{}, Dir: dir, TTL: identityCacheTTL}
+	for _, s := range cmd.Args().Slice() {
+		atid, err := syntax.ParseAtIdentifier(s)
+		if err != nil {
+			return err
+		}
+		if err := dcd.Purge(ctx, atid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+var ErrIdentityCheckFailed = errors.New("identity check failed")
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+type checkResult struct {
+	Name    string
+	Status  string
+	Message string
+}
+
+// list of named checks, printed as a status report (for 'resolve --check' and 'repo verify')
+type checkReport struct {
+	checks []checkResult
+}
+
+func (c *checkReport) add(name, status, format string, args ...any) {
+	c.checks = append(c.checks, checkResult{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checkReport) failed() bool {
+	for _, chk := range c.checks {
+		if chk.Status == checkFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checkReport) print() {
+	for _, chk := range c.checks {
+		switch chk.Status {
+		case checkPass:
+			fmt.Printf(" 🟢 %s: %s\n", chk.Name, chk.Message)
+		case checkWarn:
+			fmt.Printf(" 🟡 %s: %s\n", chk.Name, chk.Message)
+		default:
+			fmt.Printf(" 🔴 %s: %s\n", chk.Name, chk.Message)
+		}
+	}
+}
+
+// checks each step of identity resolution separately, and prints a report. returns ErrIdentityCheckFailed if any check failed
+func runIdentityCheck(ctx context.Context, cmd *cli.Command, atid syntax.AtIdentifier) error {
+	bdir := configBaseDirectory(cmd)
+	c := checkReport{}
+	defer c.print()
+
+	var did syntax.DID
+	var handle syntax.Handle
+	if atid.IsDID() {
+		did, _ = atid.AsDID()
+	} else {
+		handle, _ = atid.AsHandle()
+		handle = handle.Normalize()
+		did = checkHandleResolution(ctx, bdir, &c, handle)
+		if did == "" {
+			return ErrIdentityCheckFailed
+		}
+	}
+
+	// DID document
+	raw, err := bdir.ResolveDIDRaw(ctx, did)
+	if err != nil {
+		c.add("did-resolution", checkFail, "%s", err)
+		return ErrIdentityCheckFailed
+	}
+	c.add("did-resolution", checkPass, "%s", did)
+
+	var doc identity.DIDDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		c.add("did-document", checkFail, "invalid JSON: %s", err)
+		return ErrIdentityCheckFailed
+	}
+	if doc.DID != did {
+		c.add("did-document", checkFail, "document 'id' does not match DID: %s", doc.DID)
+	} else if problems := checkDIDDocument(&doc); len(problems) > 0 {
+		c.add("did-document", checkWarn, "%s", strings.Join(problems, "; "))
+	} else {
+		c.add("did-document", checkPass, "valid syntax")
+	}
+	ident := identity.ParseIdentity(&doc)
+
+	// bi-directional handle verification
+	decl, err := ident.DeclaredHandle()
+	if err != nil {
+		c.add("handle-declared", checkFail, "no valid handle in DID document: %s", err)
+	} else if handle != "" {
+		if decl != handle {
+			c.add("handle-declared", checkFail, "DID document declares a different handle: %s", decl)
+		} else {
+			c.add("handle-declared", checkPass, "%s", decl)
+		}
+	} else {
+		c.add("handle-declared", checkPass, "%s", decl)
+		if checkHandleResolution(ctx, bdir, &c, decl) != did {
+			c.add("handle-bidirectional", checkFail, "declared handle does not resolve to DID")
+		} else {
+			c.add("handle-bidirectional", checkPass, "declared handle resolves to DID")
+		}
+	}
+
+	// signing key
+	pub, err := ident.PublicKey()
+	if err != nil {
+		c.add("signing-key", checkFail, "%s", err)
+	} else {
+		c.add("signing-key", checkPass, "%s", pub.DIDKey())
+	}
+
+	// PDS
+	pdsURL := ident.PDSEndpoint()
+	if pdsURL == "" {
+		c.add("pds-endpoint", checkFail, "no PDS service endpoint in DID document")
+		return ErrIdentityCheckFailed
+	}
+	u, err := url.Parse(pdsURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		c.add("pds-endpoint", checkFail, "invalid PDS URL: %s", pdsURL)
+		return ErrIdentityCheckFailed
+	} else if u.Scheme != "https" {
+		c.add("pds-endpoint", checkWarn, "PDS URL is not HTTPS: %s", pdsURL)
+	} else {
+		c.add("pds-endpoint", checkPass, "%s", pdsURL)
+	}
+
+	client := atclient.NewAPIClient(pdsURL)
+	client.Headers.Set("User-Agent", userAgentString())
+
+	desc, err := comatproto.ServerDescribeServer(ctx, client)
+	if err != nil {
+		c.add("pds-describe", checkFail, "%s", err)
+	} else {
+		c.add("pds-describe", checkPass, "server DID %s", desc.Did)
+	}
+
+	status, err := comatproto.SyncGetRepoStatus(ctx, client, did.String())
+	if err != nil {
+		c.add("repo-status", checkFail, "%s", err)
+	} else if !status.Active {
+		reason := "unknown"
+		if status.Status != nil {
+			reason = *status.Status
+		}
+		c.add("repo-status", checkFail, "repo is not active (%s)", reason)
+	} else {
+		rev := ""
+		if status.Rev != nil {
+			rev = *status.Rev
+		}
+		c.add("repo-status", checkPass, "active (rev %s)", rev)
+	}
+
+	if c.failed() {
+		return ErrIdentityCheckFailed
+	}
+	return nil
+}
+
+// checks DNS and HTTPS handle resolution methods independently. returns the resolved DID, or empty string if resolution failed
+func checkHandleResolution(ctx context.Context, bdir *identity.BaseDirectory, c *checkReport, handle syntax.Handle) syntax.DID {
+	dnsDID, dnsErr := bdir.ResolveHandleDNS(ctx, handle)
+	httpDID, httpErr := bdir.ResolveHandleWellKnown(ctx, handle)
+
+	if dnsErr != nil && httpErr != nil {
+		c.add("handle-dns", checkFail, "%s", dnsErr)
+		c.add("handle-https", checkFail, "%s", httpErr)
+		return ""
+	}
+	if dnsErr != nil {
+		c.add("handle-dns", checkWarn, "%s", dnsErr)
+	} else {
+		c.add("handle-dns", checkPass, "%s", dnsDID)
+	}
+	if httpErr != nil {
+		c.add("handle-https", checkWarn, "%s", httpErr)
+	} else {
+		c.add("handle-https", checkPass, "%s", httpDID)
+	}
+
+	if dnsErr == nil && httpErr == nil && dnsDID != httpDID {
+		c.add("handle-resolution", checkFail, "DNS and HTTPS resolve to different DIDs")
+		return ""
+	}
+	if dnsErr == nil {
+		return dnsDID
+	}
+	return httpDID
+}
+
+// returns a list of syntax problems with a DID document (which still parsed as JSON)
+func checkDIDDocument(doc *identity.DIDDocument) []string {
+	problems := []string{}
+	for _, aka := range doc.AlsoKnownAs {
+		if strings.HasPrefix(aka, "at://") {
+			if _, err := syntax.ParseHandle(strings.TrimPrefix(aka, "at://")); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid handle URI in alsoKnownAs: %s", aka))
+			}
+		}
+	}
+	for _, vm := range doc.VerificationMethod {
+		if err := parseDIDRef(vm.ID); err != nil && !strings.HasPrefix(vm.ID, "#") {
+			problems = append(problems, fmt.Sprintf("invalid verification method ID: %s", vm.ID))
+		}
+		if vm.Controller != doc.DID.String() {
+			problems = append(problems, fmt.Sprintf("verification method has different controller: %s", vm.ID))
+		}
+	}
+	for _, svc := range doc.Service {
+		if !strings.Contains(svc.ID, "#") {
+			problems = append(problems, fmt.Sprintf("invalid service ID: %s", svc.ID))
+		}
+		if _, err := url.Parse(svc.ServiceEndpoint); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid service endpoint: %s", svc.ServiceEndpoint))
+		}
+	}
+	return problems
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/bluesky-social/indigo/atproto/atcrypto"
 
@@ -26,20 +31,80 @@ var cmdKey = &cli.Command{
 					Name:  "terse",
 					Usage: "print just the secret key, in multikey format",
 				},
+				&cli.StringFlag{
+					Name:  "save",
+					Usage: "store secret key in the encrypted keystore with this name (instead of printing it)",
+				},
 			},
 			Action: runKeyGenerate,
 		},
 		&cli.Command{
 			Name:      "inspect",
 			Usage:     "parses and outputs metadata about a public or secret key",
-			ArgsUsage: `<key>`,
-			Action:    runKeyInspect,
+			ArgsUsage: `<key|->`,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "type",
+					Aliases: []string{"t"},
+					Usage:   "curve type, required for hex-encoded keys (P-256 or K-256)",
+				},
+			},
+			Action: runKeyInspect,
+		},
+		&cli.Command{
+			Name:        "convert",
+			Usage:       "convert a public or secret key between encodings",
+			Description: "Input can be multibase, did:key, PEM (SPKI, PKCS#8, or SEC1), JWK, or hex. Use '-' to read from stdin (eg, for PEM or JWK).",
+			ArgsUsage:   `<key|->`,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "to",
+					Required: true,
+					Usage:    "output encoding: pem, jwk, multibase, didkey, hex",
+				},
+				&cli.StringFlag{
+					Name:    "type",
+					Aliases: []string{"t"},
+					Usage:   "curve type, required for hex-encoded keys (P-256 or K-256)",
+				},
+				&cli.BoolFlag{
+					Name:  "public",
+					Usage: "output the public key, even if a secret key was provided",
+				},
+			},
+			Action: runKeyConvert,
+		},
+		&cli.Command{
+			Name:    "list",
+			Aliases: []string{"ls"},
+			Usage:   "list keys in the encrypted keystore",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "json",
+					Usage: "print output as JSON lines",
+				},
+			},
+			Action: runKeyList,
 		},
+		&cli.Command{
+			Name:      "export",
+			Usage:     "print a secret key from the encrypted keystore (multibase syntax)",
+			ArgsUsage: `<name>`,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "public",
+					Usage: "only print the public key (did:key syntax); does not require passphrase",
+				},
+			},
+			Action: runKeyExport,
+		},
+		cmdKeySign,
+		cmdKeyVerify,
 	},
 }
 
 func runKeyGenerate(ctx context.Context, cmd *cli.Command) error {
-	var priv atcrypto.PrivateKey
+	var priv atcrypto.PrivateKeyExportable
 	var privMultibase string
 	switch cmd.String("type") {
 	case "", "P-256", "p256", "ES256", "secp256r1":
@@ -59,14 +124,38 @@ func runKeyGenerate(ctx context.Context, cmd *cli.Command) error {
 	default:
 		return fmt.Errorf("unknown key type: %s", cmd.String("type"))
 	}
-	if cmd.Bool("terse") {
-		fmt.Println(privMultibase)
-		return nil
-	}
 	pub, err := priv.PublicKey()
 	if err != nil {
 		return err
 	}
+	name := strings.TrimPrefix(cmd.String("save"), "@")
+	if name != "" {
+		if _, err := readKeystoreEntry(name); err == nil {
+			return fmt.Errorf("keystore name already in use: %s", name)
+		} else if !errors.Is(err, ErrKeystoreKeyNotFound) {
+			return err
+		}
+		passphrase, err := keystorePassphrase(true)
+		if err != nil {
+			return err
+		}
+		fpath, err := saveKeystoreKey(name, priv, passphrase)
+		if err != nil {
+			return err
+		}
+		if cmd.Bool("terse") {
+			fmt.Println(pub.DIDKey())
+			return nil
+		}
+		fmt.Printf("Key Type: %s\n", descKeyType(priv))
+		fmt.Printf("Secret Key: saved to keystore as @%s (%s)\n", name, fpath)
+		fmt.Printf("Public Key (DID Key Syntax): share or publish this (eg, in DID document)\n\t%s\n", pub.DIDKey())
+		return nil
+	}
+	if cmd.Bool("terse") {
+		fmt.Println(privMultibase)
+		return nil
+	}
 	fmt.Printf("Key Type: %s\n", descKeyType(priv))
 	fmt.Printf("Secret Key (Multibase Syntax): save this securely (eg, add to password manager)\n\t%s\n", privMultibase)
 	fmt.Printf("Public Key (DID Key Syntax): share or publish this (eg, in DID document)\n\t%s\n", pub.DIDKey())
@@ -88,17 +177,37 @@ func descKeyType(val any) string {
 	}
 }
 
-func runKeyInspect(ctx context.Context, cmd *cli.Command) error {
+// reads a key argument, which may be '-' for stdin
+func keyArg(cmd *cli.Command) (string, error) {
 	s := cmd.Args().First()
 	if s == "" {
-		return fmt.Errorf("need to provide key as an argument")
+		return "", fmt.Errorf("need to provide key as an argument")
+	}
+	if s != stdIOPath {
+		return s, nil
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
 	}
+	return string(b), nil
+}
 
-	sec, err := atcrypto.ParsePrivateMultibase(s)
-	if nil == err {
-		fmt.Printf("Type: %s\n", descKeyType(sec))
-		fmt.Printf("Encoding: multibase\n")
-		pub, err := sec.PublicKey()
+func runKeyInspect(ctx context.Context, cmd *cli.Command) error {
+	s, err := keyArg(cmd)
+	if err != nil {
+		return err
+	}
+
+	pk, err := parseKeyAny(s, cmd.String("type"))
+	if err != nil {
+		return err
+	}
+
+	if pk.Private != nil {
+		fmt.Printf("Type: %s\n", descKeyType(pk.Private))
+		fmt.Printf("Encoding: %s\n", pk.Encoding)
+		pub, err := pk.Private.PublicKey()
 		if err != nil {
 			return err
 		}
@@ -106,20 +215,79 @@ func runKeyInspect(ctx context.Context, cmd *cli.Command) error {
 		return nil
 	}
 
-	pub, err := atcrypto.ParsePublicMultibase(s)
-	if nil == err {
-		fmt.Printf("Type: %s\n", descKeyType(pub))
-		fmt.Printf("Encoding: multibase\n")
-		fmt.Printf("As DID Key: %s\n", pub.DIDKey())
-		return nil
+	fmt.Printf("Type: %s\n", descKeyType(pk.Public))
+	fmt.Printf("Encoding: %s\n", pk.Encoding)
+	if pk.Encoding != "DID Key" {
+		fmt.Printf("As DID Key: %s\n", pk.Public.DIDKey())
+	}
+	if pk.Encoding != "multibase" {
+		fmt.Printf("As Multibase: %s\n", pk.Public.Multibase())
+	}
+	return nil
+}
+
+func runKeyConvert(ctx context.Context, cmd *cli.Command) error {
+	s, err := keyArg(cmd)
+	if err != nil {
+		return err
+	}
+
+	pk, err := parseKeyAny(s, cmd.String("type"))
+	if err != nil {
+		return err
 	}
 
-	pub, err = atcrypto.ParsePublicDIDKey(s)
-	if nil == err {
-		fmt.Printf("Type: %s\n", descKeyType(pub))
-		fmt.Printf("Encoding: DID Key\n")
-		fmt.Printf("As Multibase: %s\n", pub.Multibase())
+	out, err := encodeKey(pk, strings.ToLower(cmd.String("to")), cmd.Bool("public"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+func runKeyList(ctx context.Context, cmd *cli.Command) error {
+	entries, err := listKeystoreEntries()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if cmd.Bool("json") {
+			b, err := json.Marshal(map[string]string{
+				"name":      entry.Name,
+				"keyType":   entry.KeyType,
+				"publicKey": entry.PublicKey,
+				"createdAt": entry.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		} else {
+			fmt.Printf("@%s\t%s\t%s\t%s\n", entry.Name, entry.KeyType, entry.PublicKey, entry.CreatedAt)
+		}
+	}
+	return nil
+}
+
+func runKeyExport(ctx context.Context, cmd *cli.Command) error {
+	name := strings.TrimPrefix(cmd.Args().First(), "@")
+	if name == "" {
+		return fmt.Errorf("need to provide keystore name as an argument")
+	}
+
+	if cmd.Bool("public") {
+		entry, err := readKeystoreEntry(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(entry.PublicKey)
 		return nil
 	}
-	return fmt.Errorf("unknown key encoding or type")
+
+	priv, err := loadKeystoreKey(name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(priv.Multibase())
+	return nil
 }
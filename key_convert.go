@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atcrypto"
+)
+
+// ASN.1 object identifiers for elliptic curve keys
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidCurveK256      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// the Go x509 package does not support secp256k1, so PEM encoding and decoding is done with these structs directly
+
+// SubjectPublicKeyInfo (RFC 5280)
+type asn1PublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// PKCS#8 PrivateKeyInfo (RFC 5208)
+type asn1PKCS8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// SEC1 ECPrivateKey (RFC 5915)
+type asn1ECPrivateKey struct {
+	Version    int
+	PrivateKey []byte
+	Curve      asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey  asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// private JWK, with the "d" field (which atcrypto.JWK does not include)
+type jwkPrivate struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	D       string `json:"d,omitempty"`
+}
+
+// result of parsing a key in any supported encoding. exactly one of Private or Public is set.
+type parsedKey struct {
+	Private  atcrypto.PrivateKeyExportable
+	Public   atcrypto.PublicKey
+	Encoding string
+}
+
+// returns the public key, either directly or derived from the private key
+func (pk *parsedKey) PublicKey() (atcrypto.PublicKey, error) {
+	if pk.Private != nil {
+		return pk.Private.PublicKey()
+	}
+	return pk.Public, nil
+}
+
+// normalizes user-provided curve names. returns empty string if not recognized
+func normalizeKeyType(s string) string {
+	switch s {
+	case "P-256", "p256", "ES256", "secp256r1":
+		return "P-256"
+	case "K-256", "k256", "ES256K", "secp256k1":
+		return "K-256"
+	default:
+		return ""
+	}
+}
+
+// parses a public or private key in any of the supported encodings: multibase, did:key, PEM (SPKI, PKCS#8, or SEC1), JWK, or hex. Secret key references ('@<keystore-name>', 'file:<path>', 'env:<name>') are loaded with loadSigner.
+//
+// hex encoding doesn't indicate the curve, so 'keyType' must be provided for hex input (and is otherwise ignored).
+func parseKeyAny(s, keyType string) (*parsedKey, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(s, "@"), strings.HasPrefix(s, "file:"), strings.HasPrefix(s, "env:"):
+		priv, err := loadSigner(context.Background(), s)
+		if err != nil {
+			return nil, err
+		}
+		sec, ok := priv.(atcrypto.PrivateKeyExportable)
+		if !ok {
+			return nil, fmt.Errorf("secret key can not be exported: %s", s)
+		}
+		enc := "multibase"
+		if strings.HasPrefix(s, "@") {
+			enc = "keystore"
+		}
+		return &parsedKey{Private: sec, Encoding: enc}, nil
+	case strings.HasPrefix(s, "did:key:"):
+		pub, err := atcrypto.ParsePublicDIDKey(s)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedKey{Public: pub, Encoding: "DID Key"}, nil
+	case strings.HasPrefix(s, "-----BEGIN "):
+		return parseKeyPEM(s)
+	case strings.HasPrefix(s, "{"):
+		return parseKeyJWK(s)
+	case strings.HasPrefix(s, "z"):
+		sec, err := atcrypto.ParsePrivateMultibase(s)
+		if err == nil {
+			return &parsedKey{Private: sec, Encoding: "multibase"}, nil
+		}
+		pub, err := atcrypto.ParsePublicMultibase(s)
+		if err == nil {
+			return &parsedKey{Public: pub, Encoding: "multibase"}, nil
+		}
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err == nil {
+		return parseKeyHex(raw, keyType)
+	}
+	return nil, fmt.Errorf("unknown key encoding or type")
+}
+
+func parseKeyHex(raw []byte, keyType string) (*parsedKey, error) {
+	kt := normalizeKeyType(keyType)
+	if kt == "" {
+		return nil, fmt.Errorf("hex-encoded keys require key type to be specified (eg, --type P-256)")
+	}
+	enc := "hex"
+	switch len(raw) {
+	case 32:
+		priv, err := parsePrivateBytes(raw, kt)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedKey{Private: priv, Encoding: enc}, nil
+	case 33, 65:
+		pub, err := parsePublicBytes(raw, kt)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedKey{Public: pub, Encoding: enc}, nil
+	default:
+		return nil, fmt.Errorf("unexpected hex key length: %d bytes", len(raw))
+	}
+}
+
+func parsePrivateBytes(raw []byte, keyType string) (atcrypto.PrivateKeyExportable, error) {
+	switch keyType {
+	case "P-256":
+		return atcrypto.ParsePrivateBytesP256(raw)
+	case "K-256":
+		return atcrypto.ParsePrivateBytesK256(raw)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+}
+
+// handles both compressed (33 byte) and uncompressed (65 byte) encodings
+func parsePublicBytes(raw []byte, keyType string) (atcrypto.PublicKey, error) {
+	switch keyType {
+	case "P-256":
+		if len(raw) == 65 {
+			return atcrypto.ParsePublicUncompressedBytesP256(raw)
+		}
+		return atcrypto.ParsePublicBytesP256(raw)
+	case "K-256":
+		if len(raw) == 65 {
+			return atcrypto.ParsePublicUncompressedBytesK256(raw)
+		}
+		return atcrypto.ParsePublicBytesK256(raw)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+}
+
+func keyTypeForCurveOID(oid asn1.ObjectIdentifier) (string, error) {
+	switch {
+	case oid.Equal(oidCurveP256):
+		return "P-256", nil
+	case oid.Equal(oidCurveK256):
+		return "K-256", nil
+	default:
+		return "", fmt.Errorf("unsupported elliptic curve: %s", oid)
+	}
+}
+
+func curveOIDForKeyType(keyType string) (asn1.ObjectIdentifier, error) {
+	switch keyType {
+	case "P-256":
+		return oidCurveP256, nil
+	case "K-256":
+		return oidCurveK256, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", keyType)
+	}
+}
+
+func parseKeyPEM(s string) (*parsedKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM data")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		var spki asn1PublicKeyInfo
+		if _, err := asn1.Unmarshal(block.Bytes, &spki); err != nil {
+			return nil, fmt.Errorf("invalid SPKI public key: %w", err)
+		}
+		if !spki.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+			return nil, fmt.Errorf("unsupported public key algorithm: %s", spki.Algorithm.Algorithm)
+		}
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &curve); err != nil {
+			return nil, fmt.Errorf("invalid public key curve parameter: %w", err)
+		}
+		kt, err := keyTypeForCurveOID(curve)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := parsePublicBytes(spki.PublicKey.RightAlign(), kt)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedKey{Public: pub, Encoding: "PEM (SPKI)"}, nil
+	case "PRIVATE KEY":
+		var p8 asn1PKCS8
+		if _, err := asn1.Unmarshal(block.Bytes, &p8); err != nil {
+			return nil, fmt.Errorf("invalid PKCS#8 private key: %w", err)
+		}
+		if !p8.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+			return nil, fmt.Errorf("unsupported private key algorithm: %s", p8.Algorithm.Algorithm)
+		}
+		var curve asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(p8.Algorithm.Parameters.FullBytes, &curve); err != nil {
+			return nil, fmt.Errorf("invalid private key curve parameter: %w", err)
+		}
+		priv, err := parseSEC1(p8.PrivateKey, curve)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedKey{Private: priv, Encoding: "PEM (PKCS#8)"}, nil
+	case "EC PRIVATE KEY":
+		priv, err := parseSEC1(block.Bytes, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &parsedKey{Private: priv, Encoding: "PEM (SEC1)"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+}
+
+// parses SEC1 private key bytes. the curve can come from an enclosing PKCS#8 structure, or from the SEC1 structure itself
+func parseSEC1(der []byte, curve asn1.ObjectIdentifier) (atcrypto.PrivateKeyExportable, error) {
+	var ec asn1ECPrivateKey
+	if _, err := asn1.Unmarshal(der, &ec); err != nil {
+		return nil, fmt.Errorf("invalid SEC1 private key: %w", err)
+	}
+	if len(ec.Curve) > 0 {
+		if len(curve) > 0 && !curve.Equal(ec.Curve) {
+			return nil, fmt.Errorf("mismatched private key curve parameters")
+		}
+		curve = ec.Curve
+	}
+	kt, err := keyTypeForCurveOID(curve)
+	if err != nil {
+		return nil, err
+	}
+	if len(ec.PrivateKey) > 32 {
+		return nil, fmt.Errorf("invalid private key length: %d", len(ec.PrivateKey))
+	}
+	// left-pad scalar to fixed size
+	raw := make([]byte, 32)
+	copy(raw[32-len(ec.PrivateKey):], ec.PrivateKey)
+	return parsePrivateBytes(raw, kt)
+}
+
+func parseKeyJWK(s string) (*parsedKey, error) {
+	var jwk jwkPrivate
+	if err := json.Unmarshal([]byte(s), &jwk); err != nil {
+		return nil, fmt.Errorf("parsing JWK JSON: %w", err)
+	}
+	pub, err := atcrypto.ParsePublicJWK(atcrypto.JWK{
+		KeyType: jwk.KeyType,
+		Curve:   jwk.Curve,
+		X:       jwk.X,
+		Y:       jwk.Y,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if jwk.D == "" {
+		return &parsedKey{Public: pub, Encoding: "JWK"}, nil
+	}
+
+	d, err := base64.RawURLEncoding.DecodeString(jwk.D)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWK base64 encoding: %w", err)
+	}
+	priv, err := parsePrivateBytes(d, keyTypeName(pub))
+	if err != nil {
+		return nil, err
+	}
+	derived, err := priv.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !derived.Equal(pub) {
+		return nil, fmt.Errorf("JWK private key does not match public key coordinates")
+	}
+	return &parsedKey{Private: priv, Encoding: "JWK"}, nil
+}
+
+// encodes a key in the requested format ("pem", "jwk", "multibase", "didkey", or "hex"). if 'public' is true, or the format is "didkey", private keys are converted to the public key
+func encodeKey(pk *parsedKey, format string, public bool) (string, error) {
+	pub, err := pk.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	priv := pk.Private
+	if public || format == "didkey" {
+		priv = nil
+	}
+	kt := keyTypeName(pub)
+
+	switch format {
+	case "multibase":
+		if priv != nil {
+			return priv.Multibase(), nil
+		}
+		return pub.Multibase(), nil
+	case "didkey":
+		return pub.DIDKey(), nil
+	case "hex":
+		if priv != nil {
+			return hex.EncodeToString(priv.Bytes()), nil
+		}
+		return hex.EncodeToString(pub.Bytes()), nil
+	case "jwk":
+		raw := pub.UncompressedBytes()
+		if len(raw) != 65 {
+			return "", fmt.Errorf("unexpected public key size")
+		}
+		jwk := jwkPrivate{
+			KeyType: "EC",
+			Curve:   "P-256",
+			X:       base64.RawURLEncoding.EncodeToString(raw[1:33]),
+			Y:       base64.RawURLEncoding.EncodeToString(raw[33:65]),
+		}
+		if kt == "K-256" {
+			jwk.Curve = "secp256k1"
+		}
+		if priv != nil {
+			jwk.D = base64.RawURLEncoding.EncodeToString(priv.Bytes())
+		}
+		b, err := json.MarshalIndent(jwk, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	case "pem":
+		curve, err := curveOIDForKeyType(kt)
+		if err != nil {
+			return "", err
+		}
+		curveBytes, err := asn1.Marshal(curve)
+		if err != nil {
+			return "", err
+		}
+		algo := pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: curveBytes},
+		}
+		pubBits := asn1.BitString{Bytes: pub.UncompressedBytes(), BitLength: 8 * len(pub.UncompressedBytes())}
+		var block pem.Block
+		if priv != nil {
+			sec1, err := asn1.Marshal(asn1ECPrivateKey{
+				Version:    1,
+				PrivateKey: priv.Bytes(),
+				PublicKey:  pubBits,
+			})
+			if err != nil {
+				return "", err
+			}
+			der, err := asn1.Marshal(asn1PKCS8{
+				Version:    0,
+				Algorithm:  algo,
+				PrivateKey: sec1,
+			})
+			if err != nil {
+				return "", err
+			}
+			block = pem.Block{Type: "PRIVATE KEY", Bytes: der}
+		} else {
+			der, err := asn1.Marshal(asn1PublicKeyInfo{
+				Algorithm: algo,
+				PublicKey: pubBits,
+			})
+			if err != nil {
+				return "", err
+			}
+			block = pem.Block{Type: "PUBLIC KEY", Bytes: der}
+		}
+		return strings.TrimSpace(string(pem.EncodeToMemory(&block))), nil
+	default:
+		return "", fmt.Errorf("unknown key output format: %s", format)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/atcrypto"
+	"github.com/bluesky-social/indigo/atproto/auth"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// loads a signing key from a key reference string. the supported syntaxes are:
+//
+//   - a secret key in multibase syntax (as printed by 'goat key generate')
+//   - 'file:<path>': file containing a multibase secret key
+//   - 'env:<name>': environment variable containing a multibase secret key
+//   - 'exec:<command>': external signing process (see ExternalSigner)
+//   - '@<name>': key from the encrypted keystore (see 'goat key generate --save')
+//
+// keys stay behind the atcrypto.PrivateKey interface, so external signers can be used anywhere a local key can.
+func loadSigner(ctx context.Context, ref string) (atcrypto.PrivateKey, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil, fmt.Errorf("empty signing key reference")
+	}
+
+	switch {
+	case strings.HasPrefix(ref, "file:"):
+		p := strings.TrimPrefix(ref, "file:")
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading signing key file: %w", err)
+		}
+		return parseSecretKey(strings.TrimSpace(string(b)))
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		val := os.Getenv(name)
+		if val == "" {
+			return nil, fmt.Errorf("signing key environment variable not set: %s", name)
+		}
+		return parseSecretKey(strings.TrimSpace(val))
+	case strings.HasPrefix(ref, "exec:"):
+		return NewExternalSigner(ctx, strings.TrimPrefix(ref, "exec:"))
+	case strings.HasPrefix(ref, "@"):
+		return loadKeystoreKey(strings.TrimPrefix(ref, "@"))
+	default:
+		return parseSecretKey(ref)
+	}
+}
+
+func parseSecretKey(s string) (atcrypto.PrivateKey, error) {
+	sec, err := atcrypto.ParsePrivateMultibase(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing private key: %w", err)
+	}
+	return sec, nil
+}
+
+// Signs by calling out to an external process, for keys which are held in hardware, a vault service, etc.
+//
+// The process is run once per request. It receives a single JSON object on stdin, and must write a single JSON object to stdout:
+//
+//	{"method": "publicKey"}                   ->  {"publicKey": "did:key:..."}
+//	{"method": "sign", "data": "<base64>"}    ->  {"signature": "<base64>"}
+//
+// For 'sign', the process must SHA-256 hash the data and return a compact (r||s), low-S ECDSA signature. Failures can be reported as {"error": "..."}, or a non-zero exit status. Signatures are verified against the public key before being used.
+type ExternalSigner struct {
+	Command []string
+	Timeout time.Duration
+
+	pub atcrypto.PublicKey
+}
+
+var _ atcrypto.PrivateKey = (*ExternalSigner)(nil)
+
+type externalSignerRequest struct {
+	Method string `json:"method"`
+	Data   string `json:"data,omitempty"`
+}
+
+type externalSignerResponse struct {
+	PublicKey string `json:"publicKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Creates an ExternalSigner and fetches the public key (which also confirms the process works). The command string is split on whitespace; there is no shell quoting.
+func NewExternalSigner(ctx context.Context, command string) (*ExternalSigner, error) {
+	parts := strings.Fields(command)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty external signer command")
+	}
+	es := ExternalSigner{
+		Command: parts,
+		Timeout: 60 * time.Second,
+	}
+	resp, err := es.call(ctx, externalSignerRequest{Method: "publicKey"})
+	if err != nil {
+		return nil, err
+	}
+	pub, err := atcrypto.ParsePublicDIDKey(resp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("external signer returned invalid public key: %w", err)
+	}
+	es.pub = pub
+	return &es, nil
+}
+
+func (es *ExternalSigner) call(ctx context.Context, req externalSignerRequest) (*externalSignerResponse, error) {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, es.Timeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, es.Command[0], es.Command[1:]...)
+	c.Stdin = bytes.NewReader(reqBytes)
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return nil, fmt.Errorf("external signer failed (%s): %w", req.Method, err)
+	}
+
+	var resp externalSignerResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("external signer returned invalid JSON: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("external signer error (%s): %s", req.Method, resp.Error)
+	}
+	return &resp, nil
+}
+
+func (es *ExternalSigner) Equal(other atcrypto.PrivateKey) bool {
+	otherPub, err := other.PublicKey()
+	if err != nil {
+		return false
+	}
+	return es.pub.Equal(otherPub)
+}
+
+func (es *ExternalSigner) PublicKey() (atcrypto.PublicKey, error) {
+	return es.pub, nil
+}
+
+func (es *ExternalSigner) HashAndSign(content []byte) ([]byte, error) {
+	resp, err := es.call(context.Background(), externalSignerRequest{
+		Method: "sign",
+		Data:   base64.StdEncoding.EncodeToString(content),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("external signer returned invalid signature encoding: %w", err)
+	}
+	// catches wrong key, wrong hashing, or high-S signatures
+	if err := es.pub.HashAndVerify(content, sig); err != nil {
+		return nil, fmt.Errorf("external signer returned invalid signature: %w", err)
+	}
+	return sig, nil
+}
+
+// creates a signed inter-service auth token (JWT). the SDK helper only supports local key types, so tokens for external signers are assembled here.
+func signServiceAuthToken(iss syntax.DID, aud string, ttl time.Duration, lxm *syntax.NSID, priv atcrypto.PrivateKey) (string, error) {
+	es, ok := priv.(*ExternalSigner)
+	if !ok {
+		return auth.SignServiceAuth(iss, aud, ttl, lxm, priv)
+	}
+
+	var alg string
+	switch es.pub.(type) {
+	case *atcrypto.PublicKeyP256:
+		alg = "ES256"
+	case *atcrypto.PublicKeyK256:
+		alg = "ES256K"
+	default:
+		return "", fmt.Errorf("unknown signing key type: %T", es.pub)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]any{
+		"iss": iss.String(),
+		"aud": aud,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+		"jti": base64.RawURLEncoding.EncodeToString(nonce),
+	}
+	if lxm != nil {
+		claims["lxm"] = lxm.String()
+	}
+
+	headerJSON, err := json.Marshal(map[string]string{"typ": "JWT", "alg": alg})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingString := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	sig, err := es.HashAndSign([]byte(signingString))
+	if err != nil {
+		return "", err
+	}
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atcrypto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/adrg/xdg"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+var ErrKeystoreKeyNotFound = errors.New("key not found in keystore")
+
+// scrypt parameters for new keystore entries (existing entries store their own)
+const (
+	keystoreScryptN = 1 << 15
+	keystoreScryptR = 8
+	keystoreScryptP = 1
+)
+
+var keystoreNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// A single passphrase-encrypted secret key, stored as a JSON file in the keystore directory.
+//
+// The secret key (multibase syntax) is encrypted with AES-256-GCM, using a key derived from the passphrase with scrypt. Public metadata is stored in the clear, so keys can be listed without a passphrase.
+type KeystoreEntry struct {
+	Name       string `json:"name"`
+	KeyType    string `json:"keyType"`
+	PublicKey  string `json:"publicKey"`
+	CreatedAt  string `json:"createdAt"`
+	KDF        string `json:"kdf"`
+	ScryptN    int    `json:"scryptN"`
+	ScryptR    int    `json:"scryptR"`
+	ScryptP    int    `json:"scryptP"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func keystoreDir() (string, error) {
+	// xdg.ConfigFile creates parent directories as needed
+	p, err := xdg.ConfigFile("goat/keys/.keep")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(p), nil
+}
+
+func keystorePath(name string) (string, error) {
+	if !keystoreNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid keystore name (letters, digits, '.', '_', '-' only): %s", name)
+	}
+	dir, err := keystoreDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// reads passphrase from GOAT_KEYSTORE_PASSPHRASE env var, or prompts on the terminal. if 'confirm' is true, the prompt is repeated (for new keys).
+func keystorePassphrase(confirm bool) ([]byte, error) {
+	if pass := os.Getenv("GOAT_KEYSTORE_PASSPHRASE"); pass != "" {
+		return []byte(pass), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("keystore passphrase required (set GOAT_KEYSTORE_PASSPHRASE, or run interactively)")
+	}
+	fmt.Fprint(os.Stderr, "keystore passphrase: ")
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("empty keystore passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "confirm passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(pass) {
+			return nil, fmt.Errorf("passphrases did not match")
+		}
+	}
+	return pass, nil
+}
+
+func keystoreAEAD(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	dk, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypts and saves a secret key to the keystore. fails if the name is already in use.
+func saveKeystoreKey(name string, priv atcrypto.PrivateKeyExportable, passphrase []byte) (string, error) {
+	fpath, err := keystorePath(name)
+	if err != nil {
+		return "", err
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	entry := KeystoreEntry{
+		Name:      name,
+		KeyType:   keyTypeName(priv),
+		PublicKey: pub.DIDKey(),
+		CreatedAt: syntax.DatetimeNow().String(),
+		KDF:       "scrypt",
+		ScryptN:   keystoreScryptN,
+		ScryptR:   keystoreScryptR,
+		ScryptP:   keystoreScryptP,
+		Salt:      make([]byte, 16),
+		Cipher:    "aes-256-gcm",
+	}
+	if _, err := rand.Read(entry.Salt); err != nil {
+		return "", err
+	}
+	aead, err := keystoreAEAD(passphrase, entry.Salt, entry.ScryptN, entry.ScryptR, entry.ScryptP)
+	if err != nil {
+		return "", err
+	}
+	entry.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(entry.Nonce); err != nil {
+		return "", err
+	}
+	// bind the ciphertext to the entry name, so files can't be swapped around
+	entry.Ciphertext = aead.Seal(nil, entry.Nonce, []byte(priv.Multibase()), []byte(name))
+
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("keystore name already in use: %s", name)
+		}
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return "", err
+	}
+	return fpath, nil
+}
+
+func readKeystoreEntry(name string) (*KeystoreEntry, error) {
+	fpath, err := keystorePath(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrKeystoreKeyNotFound, name)
+		}
+		return nil, err
+	}
+	var entry KeystoreEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, fmt.Errorf("invalid keystore file %s: %w", fpath, err)
+	}
+	return &entry, nil
+}
+
+// decrypts a keystore entry, prompting for passphrase if needed
+func loadKeystoreKey(name string) (atcrypto.PrivateKeyExportable, error) {
+	entry, err := readKeystoreEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.KDF != "scrypt" || entry.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported keystore encryption: %s / %s", entry.KDF, entry.Cipher)
+	}
+	passphrase, err := keystorePassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := keystoreAEAD(passphrase, entry.Salt, entry.ScryptN, entry.ScryptR, entry.ScryptP)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, entry.Nonce, entry.Ciphertext, []byte(entry.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore key '%s' (wrong passphrase?)", name)
+	}
+	priv, err := atcrypto.ParsePrivateMultibase(string(plain))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in keystore: %w", err)
+	}
+	return priv, nil
+}
+
+func listKeystoreEntries() ([]KeystoreEntry, error) {
+	dir, err := keystoreDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := []KeystoreEntry{}
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".json")
+		if f.IsDir() || !ok {
+			continue
+		}
+		entry, err := readKeystoreEntry(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping keystore file %s: %s\n", f.Name(), err)
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// short curve name, as used in keystore metadata
+func keyTypeName(val any) string {
+	switch val.(type) {
+	case *atcrypto.PublicKeyP256, *atcrypto.PrivateKeyP256:
+		return "P-256"
+	case *atcrypto.PublicKeyK256, *atcrypto.PrivateKeyK256:
+		return "K-256"
+	default:
+		return "unknown"
+	}
+}
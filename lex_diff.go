@@ -10,8 +10,6 @@ import (
 	"github.com/bluesky-social/indigo/atproto/syntax"
 
 	"github.com/urfave/cli/v3"
-	"github.com/yudai/gojsondiff"
-	"github.com/yudai/gojsondiff/formatter"
 )
 
 var cmdLexDiff = &cli.Command{
@@ -67,20 +65,7 @@ func compareDiff(ctx context.Context, cmd *cli.Command, nsid syntax.NSID, localJ
 	}
 
 	// compute and print diff
-	var diffString string
-	var outJSON map[string]any
-	differ := gojsondiff.New()
-	d, err := differ.Compare(localJSON, remoteJSON)
-	if err != nil {
-		return nil
-	}
-	json.Unmarshal(localJSON, &outJSON)
-	config := formatter.AsciiFormatterConfig{
-		//ShowArrayIndex: true,
-		Coloring: true,
-	}
-	formatter := formatter.NewAsciiFormatter(outJSON, config)
-	diffString, err = formatter.Format(d)
+	diffString, err := formatJSONDiff(localJSON, remoteJSON)
 	if err != nil {
 		return err
 	}
@@ -44,6 +44,27 @@ func run(args []string) error {
 				Value:   "https://plc.directory",
 				Sources: cli.EnvVars("ATP_PLC_HOST"),
 			},
+			&cli.BoolFlag{
+				Name:    "no-cache",
+				Usage:   "skip the persistent on-disk identity cache",
+				Sources: cli.EnvVars("GOAT_NO_CACHE"),
+			},
+			&cli.StringFlag{
+				Name:    "handle-method",
+				Usage:   "handle resolution method: any (DNS then HTTP), dns, or http",
+				Value:   "any",
+				Sources: cli.EnvVars("GOAT_HANDLE_METHOD"),
+			},
+			&cli.StringFlag{
+				Name:    "dns-server",
+				Usage:   "DNS server to use for handle resolution (host or host:port)",
+				Sources: cli.EnvVars("GOAT_DNS_SERVER"),
+			},
+			&cli.BoolFlag{
+				Name:  "authoritative-dns",
+				Usage: "query the authoritative nameserver if normal handle DNS resolution finds no record (use '--authoritative-dns=false' to disable)",
+				Value: true,
+			},
 		},
 	}
 	app.Commands = []*cli.Command{
@@ -51,6 +72,7 @@ func run(args []string) error {
 		cmdRecordList,
 		cmdFirehose,
 		cmdResolve,
+		cmdIdentity,
 		cmdXrpc,
 		cmdRepo,
 		cmdBlob,
@@ -78,6 +78,8 @@ var cmdPLC = &cli.Command{
 		&cli.Command{
 			Name:  "genesis",
 			Usage: "produce an unsigned genesis operation",
+			// service args contain commas, so they are not split; rotation key args are split with splitSliceArgs
+			DisableSliceFlagSeparator: true,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:  "handle",
@@ -95,6 +97,14 @@ var cmdPLC = &cli.Command{
 					Name:  "pds",
 					Usage: "atproto PDS service URL",
 				},
+				&cli.StringSliceFlag{
+					Name:  "service",
+					Usage: "additional service entry, as 'id=type,endpoint' (eg, 'atproto_labeler=AtprotoLabeler,https://labeler.example.com')",
+				},
+				&cli.StringSliceFlag{
+					Name:  "verification-method",
+					Usage: "additional verification method, as 'id=did:key' (eg, 'atproto_label=did:key:z...')",
+				},
 			},
 			Action: runPLCGenesis,
 		},
@@ -112,7 +122,7 @@ var cmdPLC = &cli.Command{
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:    "plc-signing-key",
-					Usage:   "private key used to sign operation (multibase syntax)",
+					Usage:   "private key used to sign operation (multibase syntax, '@<keystore-name>', 'file:<path>', 'env:<name>', or 'exec:<command>')",
 					Sources: cli.EnvVars("PLC_SIGNING_KEY"),
 				},
 			},
@@ -138,6 +148,8 @@ var cmdPLC = &cli.Command{
 			Name:      "update",
 			Usage:     "apply updates to a previous operation to produce a new one (but don't sign or submit it, yet)",
 			ArgsUsage: `<DID>`,
+			// service args contain commas, so they are not split; rotation key args are split with splitSliceArgs
+			DisableSliceFlagSeparator: true,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:  "prev",
@@ -163,6 +175,14 @@ var cmdPLC = &cli.Command{
 					Name:  "pds",
 					Usage: "atproto PDS service URL",
 				},
+				&cli.StringSliceFlag{
+					Name:  "service",
+					Usage: "add or replace service entry, as 'id=type,endpoint' (eg, 'atproto_labeler=AtprotoLabeler,https://labeler.example.com')",
+				},
+				&cli.StringSliceFlag{
+					Name:  "verification-method",
+					Usage: "add or replace verification method, as 'id=did:key' (eg, 'atproto_label=did:key:z...')",
+				},
 			},
 			Action: runPLCUpdate,
 		},
@@ -427,7 +447,7 @@ func runPLCGenesis(ctx context.Context, cmd *cli.Command) error {
 		Services:            services,
 	}
 
-	for _, rotationKey := range cmd.StringSlice("rotation-key") {
+	for _, rotationKey := range splitSliceArgs(cmd.StringSlice("rotation-key")) {
 		if _, err := atcrypto.ParsePublicDIDKey(rotationKey); err != nil {
 			return err
 		}
@@ -467,6 +487,10 @@ func runPLCGenesis(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
+	if err := applyPLCServiceArgs(cmd, &op); err != nil {
+		return err
+	}
+
 	res, err := json.MarshalIndent(op, "", "  ")
 	if err != nil {
 		return err
@@ -476,6 +500,93 @@ func runPLCGenesis(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// known atproto service IDs, and the service type each is expected to have
+var knownPLCServiceTypes = map[string]string{
+	"atproto_pds":     "AtprotoPersonalDataServer",
+	"atproto_labeler": "AtprotoLabeler",
+	"bsky_fg":         "BskyFeedGenerator",
+	"bsky_chat":       "BskyChatService",
+	"bsky_notif":      "BskyNotificationService",
+}
+
+// parses a service arg of the form 'id=type,endpoint'
+func parsePLCServiceArg(raw string) (string, *didplc.OpService, error) {
+	id, rest, ok := strings.Cut(raw, "=")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid service (expected 'id=type,endpoint'): %s", raw)
+	}
+	id = strings.TrimPrefix(id, "#")
+	svcType, endpoint, ok := strings.Cut(rest, ",")
+	if !ok || id == "" || svcType == "" || endpoint == "" {
+		return "", nil, fmt.Errorf("invalid service (expected 'id=type,endpoint'): %s", raw)
+	}
+
+	expectedType, known := knownPLCServiceTypes[id]
+	if known && svcType != expectedType {
+		return "", nil, fmt.Errorf("service type for '%s' must be %s, not %s", id, expectedType, svcType)
+	}
+
+	parsedUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return "", nil, err
+	}
+	if !parsedUrl.IsAbs() {
+		return "", nil, fmt.Errorf("invalid service endpoint URL for '%s': must be absolute", id)
+	}
+	return id, &didplc.OpService{
+		Type:     svcType,
+		Endpoint: endpoint,
+	}, nil
+}
+
+// parses a verification method arg of the form 'id=did:key'
+func parsePLCVerificationMethodArg(raw string) (string, string, error) {
+	id, didKey, ok := strings.Cut(raw, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid verification method (expected 'id=did:key'): %s", raw)
+	}
+	id = strings.TrimPrefix(id, "#")
+	if id == "" {
+		return "", "", fmt.Errorf("empty verification method ID: %s", raw)
+	}
+	if _, err := atcrypto.ParsePublicDIDKey(didKey); err != nil {
+		return "", "", fmt.Errorf("invalid verification method key for '%s': %w", id, err)
+	}
+	return id, didKey, nil
+}
+
+// splits comma-separated values in repeated slice flag args, for commands which set DisableSliceFlagSeparator (so that existing '--rotation-key a,b' usage keeps working)
+func splitSliceArgs(args []string) []string {
+	out := []string{}
+	for _, arg := range args {
+		for _, v := range strings.Split(arg, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// applies any repeated --service and --verification-method args to an op (overwriting existing entries with the same ID)
+func applyPLCServiceArgs(cmd *cli.Command, op *didplc.RegularOp) error {
+	for _, raw := range cmd.StringSlice("service") {
+		id, svc, err := parsePLCServiceArg(raw)
+		if err != nil {
+			return err
+		}
+		op.Services[id] = *svc
+	}
+	for _, raw := range cmd.StringSlice("verification-method") {
+		id, didKey, err := parsePLCVerificationMethodArg(raw)
+		if err != nil {
+			return err
+		}
+		op.VerificationMethods[id] = didKey
+	}
+	return nil
+}
+
 func runPLCCalcDID(ctx context.Context, cmd *cli.Command) error {
 	s := cmd.Args().First()
 	if s == "" {
@@ -538,7 +649,7 @@ func runPLCSign(ctx context.Context, cmd *cli.Command) error {
 	// Note: we do not require that the op is currently unsigned.
 	// If it's already signed, we'll re-sign it.
 
-	privkey, err := atcrypto.ParsePrivateMultibase(privStr)
+	privkey, err := loadSigner(ctx, privStr)
 	if err != nil {
 		return err
 	}
@@ -684,7 +795,7 @@ func runPLCUpdate(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	for _, rotationKey := range cmd.StringSlice("remove-rotation-key") {
+	for _, rotationKey := range splitSliceArgs(cmd.StringSlice("remove-rotation-key")) {
 		if _, err := atcrypto.ParsePublicDIDKey(rotationKey); err != nil {
 			return err
 		}
@@ -700,7 +811,7 @@ func runPLCUpdate(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
-	for _, rotationKey := range cmd.StringSlice("add-rotation-key") {
+	for _, rotationKey := range splitSliceArgs(cmd.StringSlice("add-rotation-key")) {
 		if _, err := atcrypto.ParsePublicDIDKey(rotationKey); err != nil {
 			return err
 		}
@@ -750,6 +861,10 @@ func runPLCUpdate(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
+	if err := applyPLCServiceArgs(cmd, op); err != nil {
+		return err
+	}
+
 	res, err := json.MarshalIndent(op, "", "  ")
 	if err != nil {
 		return err
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/bluesky-social/indigo/api/agnostic"
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/atclient"
-	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 
 	"github.com/urfave/cli/v3"
@@ -24,9 +27,10 @@ var cmdRecord = &cli.Command{
 		cmdRecordGet,
 		cmdRecordList,
 		&cli.Command{
-			Name:      "create",
-			Usage:     "create record from JSON",
-			ArgsUsage: `<file|->`,
+			Name:        "create",
+			Usage:       "create record from JSON, YAML, or DAG-CBOR",
+			Description: "Input format is detected from the file extension ('.json', '.yaml', '.cbor') or contents, or can be set with '--format'. YAML uses the same conventions as JSON for bytes and links ('$bytes', '$link').\nWith '--template', 'createdAt' is set if missing, '{{now}}' and '{{tid}}' string values are filled in, and a TID record key is generated.\nWith '--ndjson', creates one record per line of JSON input, and prints NDJSON results.",
+			ArgsUsage:   `<file|->`,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:    "rkey",
@@ -38,13 +42,31 @@ var cmdRecord = &cli.Command{
 					Aliases: []string{"n"},
 					Usage:   "tells PDS not to validate record Lexicon schema",
 				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "auto",
+					Usage: "record input format: auto, json, yaml, or cbor",
+				},
+				&cli.BoolFlag{
+					Name:  "template",
+					Usage: "fill in 'createdAt', '{{now}}', and '{{tid}}' values, and generate a TID record key",
+				},
+				&cli.BoolFlag{
+					Name:  "ndjson",
+					Usage: "create many records, one per line of JSON input",
+				},
+				&cli.IntFlag{
+					Name:  "points-per-hour",
+					Value: 5000,
+					Usage: "with '--ndjson', pace writes to stay within PDS rate limits (3 points each); 0 to disable",
+				},
 			},
 			Action: runRecordCreate,
 		},
 		&cli.Command{
 			Name:      "update",
-			Usage:     "replace existing record from JSON",
-			ArgsUsage: `<file>`,
+			Usage:     "replace existing record from JSON, YAML, or DAG-CBOR",
+			ArgsUsage: `<file|->`,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "rkey",
@@ -57,6 +79,11 @@ var cmdRecord = &cli.Command{
 					Aliases: []string{"n"},
 					Usage:   "tells PDS not to validate record Lexicon schema",
 				},
+				&cli.StringFlag{
+					Name:  "format",
+					Value: "auto",
+					Usage: "record input format: auto, json, yaml, or cbor",
+				},
 			},
 			Action: runRecordUpdate,
 		},
@@ -79,15 +106,42 @@ var cmdRecord = &cli.Command{
 			},
 			Action: runRecordDelete,
 		},
+		cmdRecordEdit,
+		cmdRecordPatch,
+		cmdRecordApply,
+		cmdRecordDeleteAll,
 	},
 }
 
 var cmdRecordGet = &cli.Command{
-	Name:      "get",
-	Usage:     "fetch record from the network",
-	ArgsUsage: `<at-uri>`,
-	Flags:     []cli.Flag{},
-	Action:    runRecordGet,
+	Name:        "get",
+	Usage:       "fetch record from the network",
+	Description: "With a single AT-URI, prints the record as JSON.\nWith multiple AT-URIs, or '-' to read AT-URIs from stdin (one per line), prints NDJSON with URI, CID, and record value (or error) for each.\nWith '--follow-refs', also fetches referenced records (across accounts and PDS hosts), and prints the graph of records as nested JSON (or flat NDJSON).",
+	ArgsUsage:   `<at-uri>+`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verify",
+			Usage: "fetch record with inclusion proof, and verify commit signature and MST path",
+		},
+		&cli.BoolFlag{
+			Name:  "follow-refs",
+			Usage: "also fetch records referenced by strongRefs or AT-URIs, recursively",
+		},
+		&cli.IntFlag{
+			Name:  "depth",
+			Value: 2,
+			Usage: "maximum number of hops to follow with '--follow-refs'",
+		},
+		&cli.BoolFlag{
+			Name:  "check-cids",
+			Usage: "with '--follow-refs', check that strongRef CIDs match the current record CID",
+		},
+		&cli.BoolFlag{
+			Name:  "ndjson",
+			Usage: "with '--follow-refs', print one line per record instead of nested JSON",
+		},
+	},
+	Action: runRecordGet,
 }
 
 var cmdRecordList = &cli.Command{
@@ -105,16 +159,50 @@ var cmdRecordList = &cli.Command{
 			Aliases: []string{"c"},
 			Usage:   "list collections, not individual record paths",
 		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print NDJSON with URI, CID, and full record value",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only include records with 'createdAt' at or after this date or datetime",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only include records with 'createdAt' before this date or datetime",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "maximum number of records to list (0 for no limit)",
+		},
 	},
 	Action: runRecordList,
 }
 
+// one line of NDJSON output from 'goat ls --json' or multi-record 'goat get'
+type recordOutput struct {
+	URI      string           `json:"uri"`
+	CID      string           `json:"cid,omitempty"`
+	Value    *json.RawMessage `json:"value,omitempty"`
+	Verified bool             `json:"verified,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
 func runRecordGet(ctx context.Context, cmd *cli.Command) error {
-	dir := configDirectory(cmd.String("plc-host"))
+	dir := configDirectory(cmd)
+	if cmd.Bool("verify") {
+		dir = configVerifyDirectory(cmd)
+	}
 
 	uriArg := cmd.Args().First()
 	if uriArg == "" {
-		return fmt.Errorf("expected a single AT-URI argument")
+		return fmt.Errorf("expected an AT-URI argument")
+	}
+	if cmd.Bool("follow-refs") {
+		return runRecordGetRefs(ctx, cmd, dir)
+	}
+	if uriArg == stdIOPath || cmd.Args().Len() > 1 {
+		return runRecordGetMulti(ctx, cmd, dir)
 	}
 
 	aturi, err := syntax.ParseATURI(uriArg)
@@ -126,9 +214,24 @@ func runRecordGet(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	record, err := fetchRecord(ctx, *ident, aturi)
-	if err != nil {
-		return err
+	var record map[string]any
+	if cmd.Bool("verify") {
+		if ident.PDSEndpoint() == "" {
+			return fmt.Errorf("no PDS endpoint for identity")
+		}
+		c := atclient.NewAPIClient(ident.PDSEndpoint())
+		c.Headers.Set("User-Agent", userAgentString())
+		vr, err := fetchVerifiedRecord(ctx, c, ident, aturi)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "verified record %s in commit %s (rev %s)\n", vr.CID, vr.CommitCID, vr.Commit.Rev)
+		record = vr.Value
+	} else {
+		record, err = fetchRecord(ctx, *ident, aturi)
+		if err != nil {
+			return err
+		}
 	}
 
 	b, err := json.MarshalIndent(record, "", "  ")
@@ -140,6 +243,153 @@ func runRecordGet(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// returns AT-URI arguments, or reads them from stdin (one per line) if the argument is '-'
+func readURIArgs(cmd *cli.Command) ([]string, error) {
+	if cmd.Args().First() != stdIOPath {
+		return cmd.Args().Slice(), nil
+	}
+	var uris []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			uris = append(uris, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return uris, nil
+}
+
+func runRecordGetMulti(ctx context.Context, cmd *cli.Command, dir identity.Directory) error {
+	uris, err := readURIArgs(cmd)
+	if err != nil {
+		return err
+	}
+
+	// re-use API clients for records on the same PDS
+	clients := map[string]*atclient.APIClient{}
+	failed := 0
+	for _, raw := range uris {
+		out := recordOutput{URI: raw}
+		if err := fetchRecordOutput(ctx, dir, clients, &out, cmd.Bool("verify")); err != nil {
+			out.Error = err.Error()
+			failed++
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to fetch %d of %d records", failed, len(uris))
+	}
+	return nil
+}
+
+func fetchRecordOutput(ctx context.Context, dir identity.Directory, clients map[string]*atclient.APIClient, out *recordOutput, verify bool) error {
+	aturi, err := syntax.ParseATURI(out.URI)
+	if err != nil {
+		return fmt.Errorf("not a valid AT-URI: %v", err)
+	}
+	if aturi.RecordKey() == "" {
+		return fmt.Errorf("AT-URI does not include a record key")
+	}
+	ident, err := dir.Lookup(ctx, aturi.Authority())
+	if err != nil {
+		return err
+	}
+	host := ident.PDSEndpoint()
+	if host == "" {
+		return fmt.Errorf("no PDS endpoint for identity")
+	}
+	c, ok := clients[host]
+	if !ok {
+		c = atclient.NewAPIClient(host)
+		c.Headers.Set("User-Agent", userAgentString())
+		clients[host] = c
+	}
+	if verify {
+		vr, err := fetchVerifiedRecord(ctx, c, ident, aturi)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(vr.Value)
+		if err != nil {
+			return err
+		}
+		raw := json.RawMessage(b)
+		out.URI = fmt.Sprintf("at://%s/%s/%s", ident.DID, aturi.Collection(), aturi.RecordKey())
+		out.CID = vr.CID.String()
+		out.Value = &raw
+		out.Verified = true
+		return nil
+	}
+	resp, err := agnostic.RepoGetRecord(ctx, c, "", aturi.Collection().String(), ident.DID.String(), aturi.RecordKey().String())
+	if err != nil {
+		return err
+	}
+	out.URI = resp.Uri
+	if resp.Cid != nil {
+		out.CID = *resp.Cid
+	}
+	out.Value = resp.Value
+	return nil
+}
+
+// parses a date ("2024-01-31") or datetime string for record filters. empty string returns zero time
+func parseTimeFilter(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := syntax.ParseDatetimeLenient(s); err == nil {
+		return d.Time(), nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not a valid date or datetime: %s", s)
+	}
+	return t, nil
+}
+
+// extracts the 'createdAt' field from record JSON, if present and valid
+func recordCreatedAt(raw json.RawMessage) (time.Time, bool) {
+	var rec struct {
+		CreatedAt string `json:"createdAt"`
+	}
+	if err := json.Unmarshal(raw, &rec); err != nil || rec.CreatedAt == "" {
+		return time.Time{}, false
+	}
+	d, err := syntax.ParseDatetimeLenient(rec.CreatedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return d.Time(), true
+}
+
+// checks a record's 'createdAt' against a time range. either bound can be zero (unbounded). if any bound is set, records without valid 'createdAt' do not match
+func recordInTimeRange(raw *json.RawMessage, since, until time.Time) bool {
+	if since.IsZero() && until.IsZero() {
+		return true
+	}
+	if raw == nil {
+		return false
+	}
+	t, ok := recordCreatedAt(*raw)
+	if !ok {
+		return false
+	}
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	if !until.IsZero() && !t.Before(until) {
+		return false
+	}
+	return true
+}
+
 func runRecordList(ctx context.Context, cmd *cli.Command) error {
 	username := cmd.Args().First()
 	if username == "" {
@@ -172,6 +422,16 @@ func runRecordList(ctx context.Context, cmd *cli.Command) error {
 	if filter != "" {
 		collections = []string{filter}
 	}
+	since, err := parseTimeFilter(cmd.String("since"))
+	if err != nil {
+		return err
+	}
+	until, err := parseTimeFilter(cmd.String("until"))
+	if err != nil {
+		return err
+	}
+	limit := cmd.Int("limit")
+	count := 0
 
 	for _, nsid := range collections {
 		cursor := ""
@@ -182,6 +442,21 @@ func runRecordList(ctx context.Context, cmd *cli.Command) error {
 				return err
 			}
 			for _, rec := range resp.Records {
+				if !recordInTimeRange(rec.Value, since, until) {
+					continue
+				}
+				if limit > 0 && count >= int(limit) {
+					return nil
+				}
+				count++
+				if cmd.Bool("json") {
+					b, err := json.Marshal(recordOutput{URI: rec.Uri, CID: rec.Cid, Value: rec.Value})
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(b))
+					continue
+				}
 				aturi, err := syntax.ParseATURI(rec.Uri)
 				if err != nil {
 					return err
@@ -199,6 +474,30 @@ func runRecordList(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// reads a record from a file or stdin, in any supported input format
+func readRecordInput(path, format string) (map[string]any, string, error) {
+	r, err := getFileOrStdin(path)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if format == "auto" {
+		format = detectRecordFormat(path, data)
+	}
+	recordVal, err := parseRecordInput(data, format)
+	if err != nil {
+		return nil, "", err
+	}
+	nsid, err := recordType(recordVal)
+	if err != nil {
+		return nil, "", err
+	}
+	return recordVal, nsid, nil
+}
+
 func runRecordCreate(ctx context.Context, cmd *cli.Command) error {
 	recordPath := cmd.Args().First()
 	if recordPath == "" {
@@ -212,29 +511,15 @@ func runRecordCreate(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	inputReader, err := getFileOrStdin(recordPath)
-	if err != nil {
-		return err
+	if cmd.Bool("ndjson") {
+		return runRecordCreateStream(ctx, cmd, client, recordPath)
 	}
 
-	recordBytes, err := io.ReadAll(inputReader)
+	recordVal, nsid, err := readRecordInput(recordPath, cmd.String("format"))
 	if err != nil {
 		return err
 	}
 
-	recordVal, err := atdata.UnmarshalJSON(recordBytes)
-	if err != nil {
-		return err
-	}
-
-	nsid, err := atdata.ExtractTypeJSON(recordBytes)
-	if err != nil {
-		return fmt.Errorf("failed to extract '$type' from record data: %w", err)
-	}
-	if nsid == "" {
-		return fmt.Errorf("failed to parse '$type' from record data: empty or undefined")
-	}
-
 	var rkey *string
 	if cmd.String("rkey") != "" {
 		rk, err := syntax.ParseRecordKey(cmd.String("rkey"))
@@ -244,6 +529,14 @@ func runRecordCreate(ctx context.Context, cmd *cli.Command) error {
 		s := rk.String()
 		rkey = &s
 	}
+	if cmd.Bool("template") {
+		rt := newRecordTemplater()
+		rt.Apply(recordVal)
+		if rkey == nil {
+			s := rt.NextTID().String()
+			rkey = &s
+		}
+	}
 	validate := !cmd.Bool("no-validate")
 
 	resp, err := agnostic.RepoCreateRecord(ctx, client, &agnostic.RepoCreateRecord_Input{
@@ -261,35 +554,110 @@ func runRecordCreate(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
-func runRecordUpdate(ctx context.Context, cmd *cli.Command) error {
-	recordPath := cmd.Args().First()
-	if recordPath == "" {
-		return fmt.Errorf("need to provide file path as an argument")
+// creates one record per line of JSON input, continuing past failures
+func runRecordCreateStream(ctx context.Context, cmd *cli.Command, client *atclient.APIClient, recordPath string) error {
+	if cmd.String("rkey") != "" {
+		return fmt.Errorf("can not use '--rkey' with '--ndjson'")
+	}
+	if f := cmd.String("format"); f != "auto" && f != "json" {
+		return fmt.Errorf("'--ndjson' input must be JSON")
+	}
+	if client.AccountDID == nil {
+		return fmt.Errorf("no account DID in auth session")
+	}
+	r, err := getFileOrStdin(recordPath)
+	if err != nil {
+		return err
 	}
 
-	client, err := loadAuthClient(ctx, cmd)
-	if err == ErrNoAuthSession {
-		return fmt.Errorf("auth required, but not logged in")
-	} else if err != nil {
+	var rt *recordTemplater
+	if cmd.Bool("template") {
+		rt = newRecordTemplater()
+	}
+	aw := applyWriter{
+		Client:        client,
+		DID:           *client.AccountDID,
+		Validate:      !cmd.Bool("no-validate"),
+		PointsPerHour: int(cmd.Int("points-per-hour")),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNum := 0
+	total := 0
+	failed := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		total++
+		res := applyResult{Line: lineNum, Action: "create"}
+		if err := createStreamRecord(ctx, &aw, rt, []byte(line), &res); err != nil {
+			res.Error = err.Error()
+			failed++
+		}
+		printApplyResult(res)
+	}
+	if err := scanner.Err(); err != nil {
 		return err
 	}
+	if failed > 0 {
+		return fmt.Errorf("failed to create %d of %d records", failed, total)
+	}
+	return nil
+}
 
-	recordBytes, err := os.ReadFile(recordPath)
+func createStreamRecord(ctx context.Context, aw *applyWriter, rt *recordTemplater, line []byte, res *applyResult) error {
+	recordVal, err := parseRecordInput(line, "json")
 	if err != nil {
 		return err
 	}
-
-	recordVal, err := atdata.UnmarshalJSON(recordBytes)
+	nsid, err := recordType(recordVal)
+	if err != nil {
+		return err
+	}
+	create := agnostic.RepoApplyWrites_Create{Collection: nsid}
+	if rt != nil {
+		rt.Apply(recordVal)
+		rkey := rt.NextTID().String()
+		create.Rkey = &rkey
+	}
+	b, err := json.Marshal(recordVal)
 	if err != nil {
 		return err
 	}
+	raw := json.RawMessage(b)
+	create.Value = &raw
 
-	nsid, err := atdata.ExtractTypeJSON(recordBytes)
+	out, err := aw.apply(ctx, []*agnostic.RepoApplyWrites_Input_Writes_Elem{{RepoApplyWrites_Create: &create}})
 	if err != nil {
-		return fmt.Errorf("failed to extract '$type' from record data: %w", err)
+		return err
+	}
+	if len(out.Results) > 0 && out.Results[0].RepoApplyWrites_CreateResult != nil {
+		res.URI = out.Results[0].RepoApplyWrites_CreateResult.Uri
+		res.CID = out.Results[0].RepoApplyWrites_CreateResult.Cid
 	}
-	if nsid == "" {
-		return fmt.Errorf("failed to parse '$type' from record data: empty or undefined")
+	return nil
+}
+
+func runRecordUpdate(ctx context.Context, cmd *cli.Command) error {
+	recordPath := cmd.Args().First()
+	if recordPath == "" {
+		return fmt.Errorf("need to provide file path or '-' for stdin as an argument")
+	}
+
+	client, err := loadAuthClient(ctx, cmd)
+	if err == ErrNoAuthSession {
+		return fmt.Errorf("auth required, but not logged in")
+	} else if err != nil {
+		return err
+	}
+
+	recordVal, nsid, err := readRecordInput(recordPath, cmd.String("format"))
+	if err != nil {
+		return err
 	}
 
 	rkey := cmd.String("rkey")
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/api/agnostic"
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+// maximum number of writes in a single applyWrites request (per Lexicon)
+const applyWritesMaxBatch = 200
+
+var cmdRecordApply = &cli.Command{
+	Name:        "apply",
+	Usage:       "apply many record writes (create, update, delete) from an NDJSON file",
+	Description: "Each input line is a JSON object like:\n\n  {\"action\": \"create\", \"collection\": \"<nsid>\", \"rkey\": \"<optional>\", \"value\": {...}}\n  {\"action\": \"update\", \"collection\": \"<nsid>\", \"rkey\": \"<rkey>\", \"value\": {...}}\n  {\"action\": \"delete\", \"collection\": \"<nsid>\", \"rkey\": \"<rkey>\"}\n\nIf 'collection' is missing, the '$type' of 'value' is used. Writes are sent in batches with com.atproto.repo.applyWrites; each batch is applied atomically. Prints NDJSON with the result of each operation.",
+	ArgsUsage:   `<file|->`,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "batch-size",
+			Value: applyWritesMaxBatch,
+			Usage: "number of writes per applyWrites request",
+		},
+		&cli.BoolFlag{
+			Name:  "swap-commit",
+			Usage: "make each batch conditional on the repo commit from the previous batch, failing if the repo was modified concurrently",
+		},
+		&cli.BoolFlag{
+			Name:    "no-validate",
+			Aliases: []string{"n"},
+			Usage:   "tells PDS not to validate record Lexicon schemas",
+		},
+		&cli.DurationFlag{
+			Name:  "delay",
+			Value: time.Second,
+			Usage: "minimum time between batches",
+		},
+		&cli.IntFlag{
+			Name:  "points-per-hour",
+			Value: 5000,
+			Usage: "pace writes to stay within PDS rate limits (create=3, update=2, delete=1 points); 0 to disable",
+		},
+	},
+	Action: runRecordApply,
+}
+
+// one line of 'goat record apply' input
+type applyOp struct {
+	Action     string           `json:"action"`
+	Collection string           `json:"collection,omitempty"`
+	Rkey       string           `json:"rkey,omitempty"`
+	Value      *json.RawMessage `json:"value,omitempty"`
+}
+
+// one line of 'goat record apply' output
+type applyResult struct {
+	Line   int    `json:"line"`
+	Action string `json:"action"`
+	URI    string `json:"uri,omitempty"`
+	CID    string `json:"cid,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// parses and checks a single operation, and converts it to an applyWrites element
+func parseApplyOp(raw []byte) (*agnostic.RepoApplyWrites_Input_Writes_Elem, *applyOp, error) {
+	var op applyOp
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if op.Collection == "" && op.Value != nil {
+		nsid, err := atdata.ExtractTypeJSON(*op.Value)
+		if err != nil {
+			return nil, &op, fmt.Errorf("failed to extract '$type' from record data: %w", err)
+		}
+		op.Collection = nsid
+	}
+	if _, err := syntax.ParseNSID(op.Collection); err != nil {
+		return nil, &op, fmt.Errorf("invalid collection: %w", err)
+	}
+	if op.Rkey != "" {
+		if _, err := syntax.ParseRecordKey(op.Rkey); err != nil {
+			return nil, &op, err
+		}
+	}
+	if op.Value != nil {
+		// check that record data is valid atproto data model
+		if _, err := atdata.UnmarshalJSON(*op.Value); err != nil {
+			return nil, &op, fmt.Errorf("invalid record data: %w", err)
+		}
+	}
+
+	switch op.Action {
+	case "create":
+		if op.Value == nil {
+			return nil, &op, fmt.Errorf("create requires 'value'")
+		}
+		elem := agnostic.RepoApplyWrites_Create{
+			Collection: op.Collection,
+			Value:      op.Value,
+		}
+		if op.Rkey != "" {
+			elem.Rkey = &op.Rkey
+		}
+		return &agnostic.RepoApplyWrites_Input_Writes_Elem{RepoApplyWrites_Create: &elem}, &op, nil
+	case "update":
+		if op.Value == nil || op.Rkey == "" {
+			return nil, &op, fmt.Errorf("update requires 'rkey' and 'value'")
+		}
+		return &agnostic.RepoApplyWrites_Input_Writes_Elem{RepoApplyWrites_Update: &agnostic.RepoApplyWrites_Update{
+			Collection: op.Collection,
+			Rkey:       op.Rkey,
+			Value:      op.Value,
+		}}, &op, nil
+	case "delete":
+		if op.Rkey == "" {
+			return nil, &op, fmt.Errorf("delete requires 'rkey'")
+		}
+		return &agnostic.RepoApplyWrites_Input_Writes_Elem{RepoApplyWrites_Delete: &agnostic.RepoApplyWrites_Delete{
+			Collection: op.Collection,
+			Rkey:       op.Rkey,
+		}}, &op, nil
+	default:
+		return nil, &op, fmt.Errorf("unknown action: %s", op.Action)
+	}
+}
+
+func applyWritePoints(elem *agnostic.RepoApplyWrites_Input_Writes_Elem) int {
+	switch {
+	case elem.RepoApplyWrites_Create != nil:
+		return 3
+	case elem.RepoApplyWrites_Update != nil:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Sends batches of writes with applyWrites, pacing requests to stay within rate limits.
+type applyWriter struct {
+	Client        *atclient.APIClient
+	DID           syntax.DID
+	Validate      bool
+	SwapCommit    bool
+	Delay         time.Duration
+	PointsPerHour int
+
+	commitCID  string
+	budget     float64
+	refilledAt time.Time
+	lastBatch  time.Time
+}
+
+// waits as needed so that a batch with the given write points stays within rate limits
+func (aw *applyWriter) pace(ctx context.Context, points int) error {
+	wait := time.Duration(0)
+	if !aw.lastBatch.IsZero() {
+		wait = aw.Delay - time.Since(aw.lastBatch)
+	}
+	rate := float64(aw.PointsPerHour) / time.Hour.Seconds()
+	if aw.PointsPerHour > 0 {
+		// token bucket: starts full, and refills continuously
+		if aw.refilledAt.IsZero() {
+			aw.budget = float64(aw.PointsPerHour)
+		} else {
+			aw.budget = min(float64(aw.PointsPerHour), aw.budget+time.Since(aw.refilledAt).Seconds()*rate)
+		}
+		aw.refilledAt = time.Now()
+		if deficit := float64(points) - aw.budget; deficit > 0 {
+			wait = max(wait, time.Duration(deficit/rate*float64(time.Second)))
+		}
+	}
+	if wait > 0 {
+		fmt.Fprintf(os.Stderr, "pacing writes: waiting %s\n", wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	if aw.PointsPerHour > 0 {
+		aw.budget = min(float64(aw.PointsPerHour), aw.budget+time.Since(aw.refilledAt).Seconds()*rate)
+		aw.refilledAt = time.Now()
+	}
+	return nil
+}
+
+func (aw *applyWriter) apply(ctx context.Context, writes []*agnostic.RepoApplyWrites_Input_Writes_Elem) (*agnostic.RepoApplyWrites_Output, error) {
+	points := 0
+	for _, w := range writes {
+		points += applyWritePoints(w)
+	}
+	if err := aw.pace(ctx, points); err != nil {
+		return nil, err
+	}
+
+	if aw.SwapCommit && aw.commitCID == "" {
+		head, err := comatproto.SyncGetLatestCommit(ctx, aw.Client, aw.DID.String())
+		if err != nil {
+			return nil, fmt.Errorf("fetching current repo commit: %w", err)
+		}
+		aw.commitCID = head.Cid
+	}
+
+	input := agnostic.RepoApplyWrites_Input{
+		Repo:     aw.DID.String(),
+		Validate: &aw.Validate,
+		Writes:   writes,
+	}
+	if aw.SwapCommit {
+		input.SwapCommit = &aw.commitCID
+	}
+
+	var out *agnostic.RepoApplyWrites_Output
+	err := retryRateLimited(ctx, func() error {
+		var err error
+		out, err = agnostic.RepoApplyWrites(ctx, aw.Client, &input)
+		aw.lastBatch = time.Now()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	aw.budget -= float64(points)
+	if out.Commit != nil {
+		aw.commitCID = out.Commit.Cid
+	}
+	return out, nil
+}
+
+// deletes a single record (with com.atproto.repo.deleteRecord), only if its current CID matches swapRecord. paced and retried the same way as apply
+func (aw *applyWriter) deleteRecord(ctx context.Context, collection syntax.NSID, rkey, swapRecord string) error {
+	if err := aw.pace(ctx, 1); err != nil {
+		return err
+	}
+	err := retryRateLimited(ctx, func() error {
+		_, err := comatproto.RepoDeleteRecord(ctx, aw.Client, &comatproto.RepoDeleteRecord_Input{
+			Collection: collection.String(),
+			Repo:       aw.DID.String(),
+			Rkey:       rkey,
+			SwapRecord: &swapRecord,
+		})
+		aw.lastBatch = time.Now()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	aw.budget--
+	return nil
+}
+
+// calls f, retrying with back-off while the PDS responds that requests are rate-limited
+func retryRateLimited(ctx context.Context, f func() error) error {
+	backoff := 30 * time.Second
+	for attempt := 0; ; attempt++ {
+		err := f()
+		var apiErr *atclient.APIError
+		if err != nil && errors.As(err, &apiErr) && apiErr.StatusCode == 429 && attempt < 5 {
+			fmt.Fprintf(os.Stderr, "rate limited by PDS: waiting %s\n", backoff)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			continue
+		}
+		return err
+	}
+}
+
+func runRecordApply(ctx context.Context, cmd *cli.Command) error {
+	p := cmd.Args().First()
+	if p == "" {
+		return fmt.Errorf("need to provide file path or '-' for stdin as an argument")
+	}
+	batchSize := int(cmd.Int("batch-size"))
+	if batchSize < 1 || batchSize > applyWritesMaxBatch {
+		return fmt.Errorf("batch size must be between 1 and %d", applyWritesMaxBatch)
+	}
+
+	client, err := loadAuthClient(ctx, cmd)
+	if err == ErrNoAuthSession {
+		return fmt.Errorf("auth required, but not logged in")
+	} else if err != nil {
+		return err
+	}
+	if client.AccountDID == nil {
+		return fmt.Errorf("no account DID in auth session")
+	}
+	did := *client.AccountDID
+
+	r, err := getFileOrStdin(p)
+	if err != nil {
+		return err
+	}
+
+	// parse and check all operations before making any writes
+	var writes []*agnostic.RepoApplyWrites_Input_Writes_Elem
+	var results []applyResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNum := 0
+	invalid := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		elem, op, err := parseApplyOp([]byte(line))
+		res := applyResult{Line: lineNum}
+		if op != nil {
+			res.Action = op.Action
+			if op.Rkey != "" {
+				res.URI = fmt.Sprintf("at://%s/%s/%s", did, op.Collection, op.Rkey)
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+			invalid++
+		}
+		writes = append(writes, elem)
+		results = append(results, res)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if invalid > 0 {
+		for _, res := range results {
+			if res.Error != "" {
+				printApplyResult(res)
+			}
+		}
+		return fmt.Errorf("%d invalid operations; no writes made", invalid)
+	}
+
+	aw := applyWriter{
+		Client:        client,
+		DID:           did,
+		Validate:      !cmd.Bool("no-validate"),
+		SwapCommit:    cmd.Bool("swap-commit"),
+		Delay:         cmd.Duration("delay"),
+		PointsPerHour: int(cmd.Int("points-per-hour")),
+	}
+
+	for start := 0; start < len(writes); start += batchSize {
+		end := min(start+batchSize, len(writes))
+		out, err := aw.apply(ctx, writes[start:end])
+		if err != nil {
+			// report the failed batch, and skip the rest
+			for i := start; i < len(writes); i++ {
+				if i < end {
+					results[i].Error = err.Error()
+				} else {
+					results[i].Error = "skipped"
+				}
+				printApplyResult(results[i])
+			}
+			return fmt.Errorf("applying writes failed after %d of %d operations: %w", start, len(writes), err)
+		}
+		for i := start; i < end; i++ {
+			if j := i - start; j < len(out.Results) {
+				res := out.Results[j]
+				switch {
+				case res.RepoApplyWrites_CreateResult != nil:
+					results[i].URI = res.RepoApplyWrites_CreateResult.Uri
+					results[i].CID = res.RepoApplyWrites_CreateResult.Cid
+				case res.RepoApplyWrites_UpdateResult != nil:
+					results[i].URI = res.RepoApplyWrites_UpdateResult.Uri
+					results[i].CID = res.RepoApplyWrites_UpdateResult.Cid
+				}
+			}
+			printApplyResult(results[i])
+		}
+	}
+	return nil
+}
+
+func printApplyResult(res applyResult) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	fmt.Println(string(b))
+}
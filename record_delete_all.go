@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/agnostic"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+var cmdRecordDeleteAll = &cli.Command{
+	Name:        "delete-all",
+	Usage:       "delete all records in a collection matching filters",
+	Description: "Lists records in the current account's collection, and deletes any matching all of the filters (with com.atproto.repo.deleteRecord). Each deletion is conditional on the record CID seen when listing; records which have changed since are skipped, not deleted.\nAlways previews the number of matching records first; use '--dry-run' to only preview (printing each matching record).\nTo delete without a confirmation prompt (eg, in scripts), '--yes' must be combined with '--expect-count', set to the count from a previous preview; nothing is deleted if the number of matching records differs.",
+	// match values may contain commas
+	DisableSliceFlagSeparator: true,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "collection",
+			Aliases:  []string{"c"},
+			Required: true,
+			Usage:    "collection (NSID)",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only delete records with 'createdAt' at or after this date or datetime",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only delete records with 'createdAt' before this date or datetime",
+		},
+		&cli.StringFlag{
+			Name:  "rkey-prefix",
+			Usage: "only delete records with record key starting with this string",
+		},
+		&cli.StringSliceFlag{
+			Name:  "match",
+			Usage: "only delete records where field equals value ('<field>=<value>'; nested fields with dots, eg 'subject.uri=at://...'). may be repeated",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print matching records and count, without deleting anything",
+		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "delete without asking for confirmation (requires '--expect-count')",
+		},
+		&cli.IntFlag{
+			Name:  "expect-count",
+			Value: -1,
+			Usage: "number of matching records expected (from a '--dry-run' preview); fails without deleting if different",
+		},
+		&cli.IntFlag{
+			Name:  "points-per-hour",
+			Value: 5000,
+			Usage: "pace deletions to stay within PDS rate limits (1 point each); 0 to disable",
+		},
+	},
+	Action: runRecordDeleteAll,
+}
+
+type recordFieldMatch struct {
+	Path  []string
+	Value string
+}
+
+func parseFieldMatches(args []string) ([]recordFieldMatch, error) {
+	matches := []recordFieldMatch{}
+	for _, arg := range args {
+		field, value, ok := strings.Cut(arg, "=")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid field match (expected '<field>=<value>'): %s", arg)
+		}
+		matches = append(matches, recordFieldMatch{Path: strings.Split(field, "."), Value: value})
+	}
+	return matches, nil
+}
+
+// checks that a record has the field value. non-string values are compared in their JSON encoding (eg, 'true' or '12')
+func (m recordFieldMatch) matches(rec map[string]any) bool {
+	var val any = rec
+	for _, key := range m.Path {
+		obj, ok := val.(map[string]any)
+		if !ok {
+			return false
+		}
+		val, ok = obj[key]
+		if !ok {
+			return false
+		}
+	}
+	if s, ok := val.(string); ok {
+		return s == m.Value
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return false
+	}
+	return string(b) == m.Value
+}
+
+func runRecordDeleteAll(ctx context.Context, cmd *cli.Command) error {
+	collection, err := syntax.ParseNSID(cmd.String("collection"))
+	if err != nil {
+		return err
+	}
+	since, err := parseTimeFilter(cmd.String("since"))
+	if err != nil {
+		return err
+	}
+	until, err := parseTimeFilter(cmd.String("until"))
+	if err != nil {
+		return err
+	}
+	fieldMatches, err := parseFieldMatches(cmd.StringSlice("match"))
+	if err != nil {
+		return err
+	}
+	expectCount := int(cmd.Int("expect-count"))
+	if cmd.Bool("yes") && expectCount < 0 {
+		return fmt.Errorf("'--yes' requires '--expect-count' (run with '--dry-run' first to preview matching records)")
+	}
+	rkeyPrefix := cmd.String("rkey-prefix")
+
+	client, err := loadAuthClient(ctx, cmd)
+	if err == ErrNoAuthSession {
+		return fmt.Errorf("auth required, but not logged in")
+	} else if err != nil {
+		return err
+	}
+	if client.AccountDID == nil {
+		return fmt.Errorf("no account DID in auth session")
+	}
+	did := *client.AccountDID
+
+	// enumerate matching records before deleting anything
+	type deleteTarget struct {
+		Rkey string
+		CID  string
+	}
+	var targets []deleteTarget
+	cursor := ""
+	for {
+		resp, err := agnostic.RepoListRecords(ctx, client, collection.String(), cursor, 100, did.String(), false)
+		if err != nil {
+			return err
+		}
+		for _, rec := range resp.Records {
+			aturi, err := syntax.ParseATURI(rec.Uri)
+			if err != nil {
+				return err
+			}
+			rkey := aturi.RecordKey().String()
+			if !strings.HasPrefix(rkey, rkeyPrefix) || !recordInTimeRange(rec.Value, since, until) {
+				continue
+			}
+			if len(fieldMatches) > 0 {
+				var val map[string]any
+				if rec.Value == nil || json.Unmarshal(*rec.Value, &val) != nil {
+					continue
+				}
+				matched := true
+				for _, m := range fieldMatches {
+					if !m.matches(val) {
+						matched = false
+						break
+					}
+				}
+				if !matched {
+					continue
+				}
+			}
+			if cmd.Bool("dry-run") {
+				fmt.Printf("%s\t%s\t%s\n", collection, rkey, rec.Cid)
+			}
+			targets = append(targets, deleteTarget{Rkey: rkey, CID: rec.Cid})
+		}
+		if resp.Cursor != nil && *resp.Cursor != "" {
+			cursor = *resp.Cursor
+		} else {
+			break
+		}
+	}
+
+	fmt.Printf("%d matching records in %s\n", len(targets), collection)
+	if cmd.Bool("dry-run") {
+		if len(targets) > 0 {
+			fmt.Printf("to delete these records, run again without '--dry-run' (or with '--yes --expect-count %d')\n", len(targets))
+		}
+		return nil
+	}
+	if expectCount >= 0 && expectCount != len(targets) {
+		return fmt.Errorf("expected %d matching records, but found %d; nothing deleted", expectCount, len(targets))
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	if !cmd.Bool("yes") {
+		ok, err := confirmPrompt(fmt.Sprintf("delete %d records?", len(targets)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("deletion cancelled")
+		}
+	}
+
+	aw := applyWriter{
+		Client:        client,
+		DID:           did,
+		PointsPerHour: int(cmd.Int("points-per-hour")),
+	}
+	deleted, skipped := 0, 0
+	for i, t := range targets {
+		err := aw.deleteRecord(ctx, collection, t.Rkey, t.CID)
+		var apiErr *atclient.APIError
+		if errors.As(err, &apiErr) && apiErr.Name == "InvalidSwap" {
+			fmt.Fprintf(os.Stderr, "skipped %s/%s: record changed since listing\n", collection, t.Rkey)
+			skipped++
+			continue
+		} else if err != nil {
+			return fmt.Errorf("deletion failed after %d of %d records: %w", i, len(targets), err)
+		}
+		deleted++
+		if deleted%100 == 0 {
+			fmt.Printf("deleted %d of %d records\n", deleted, len(targets))
+		}
+	}
+	fmt.Printf("deleted %d records", deleted)
+	if skipped > 0 {
+		fmt.Printf(" (%d skipped, changed since listing)", skipped)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"github.com/bluesky-social/indigo/api/agnostic"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/lexicon"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+var cmdRecordEdit = &cli.Command{
+	Name:        "edit",
+	Usage:       "edit an existing record in a text editor",
+	Description: "Fetches a record from the current account and opens it in $VISUAL or $EDITOR. The edited record is validated against its Lexicon schema, and a diff is shown before updating.\nThe update is conditional on the original record CID, so concurrent changes are detected.",
+	ArgsUsage:   `<at-uri>`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "no-validate",
+			Aliases: []string{"n"},
+			Usage:   "skip local Lexicon validation, and tell PDS not to validate",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-legacy-blob",
+			Usage: "be permissive of legacy blobs during validation",
+		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "update without asking for confirmation",
+		},
+	},
+	Action: runRecordEdit,
+}
+
+// resolves the AT-URI argument of record-modifying commands, and checks that it is in the logged-in account's repo
+func parseOwnRecordURI(ctx context.Context, cmd *cli.Command, client *atclient.APIClient, raw string) (syntax.ATURI, error) {
+	aturi, err := syntax.ParseATURI(raw)
+	if err != nil {
+		return "", fmt.Errorf("not a valid AT-URI: %v", err)
+	}
+	if aturi.Collection() == "" || aturi.RecordKey() == "" {
+		return "", fmt.Errorf("AT-URI must include collection and record key")
+	}
+	did, err := resolveToDID(ctx, cmd, aturi.Authority().String())
+	if err != nil {
+		return "", err
+	}
+	if client.AccountDID == nil || did != *client.AccountDID {
+		return "", fmt.Errorf("record is not in the logged-in account's repo: %s", did)
+	}
+	return syntax.ParseATURI(fmt.Sprintf("at://%s/%s/%s", did, aturi.Collection(), aturi.RecordKey()))
+}
+
+// opens the file in the user's preferred editor, and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	parts := strings.Fields(editor)
+	c := exec.Command(parts[0], append(parts[1:], path)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+	return nil
+}
+
+// fetches a record from the logged-in account's repo, returning both the raw response and the parsed value
+func fetchOwnRecord(ctx context.Context, client *atclient.APIClient, aturi syntax.ATURI) (*agnostic.RepoGetRecord_Output, map[string]any, error) {
+	existing, err := agnostic.RepoGetRecord(ctx, client, "", aturi.Collection().String(), aturi.Authority().String(), aturi.RecordKey().String())
+	if err != nil {
+		return nil, nil, err
+	}
+	if existing.Value == nil || existing.Cid == nil {
+		return nil, nil, fmt.Errorf("empty record in response")
+	}
+	val, err := atdata.UnmarshalJSON(*existing.Value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetched record was invalid data: %w", err)
+	}
+	return existing, val, nil
+}
+
+var errRecordUnchanged = errors.New("no changes")
+
+// options for putRecordChecked
+type recordPutOptions struct {
+	// name for the new record version in diff output (eg, "edited")
+	Label string
+	// print a diff before updating
+	ShowDiff bool
+	// ask for confirmation before updating
+	Confirm bool
+	// print diff, but don't update
+	DryRun bool
+}
+
+// Updates a record fetched with fetchOwnRecord to a new value: checks '$type' against the collection, validates against the Lexicon schema (unless '--no-validate'), optionally prints a diff and asks for confirmation, then writes the record conditional on the original CID.
+//
+// Returns errRecordUnchanged if the new value is the same as the existing record, and a nil output for dry runs.
+func putRecordChecked(ctx context.Context, cmd *cli.Command, client *atclient.APIClient, aturi syntax.ATURI, existing *agnostic.RepoGetRecord_Output, newVal map[string]any, opts recordPutOptions) (*agnostic.RepoPutRecord_Output, error) {
+	nsid := aturi.Collection()
+	origVal, err := atdata.UnmarshalJSON(*existing.Value)
+	if err != nil {
+		return nil, fmt.Errorf("fetched record was invalid data: %w", err)
+	}
+	if reflect.DeepEqual(origVal, newVal) {
+		return nil, errRecordUnchanged
+	}
+	if newType, err := recordType(newVal); err != nil || newType != nsid.String() {
+		return nil, fmt.Errorf("%s record '$type' must match collection %s", opts.Label, nsid)
+	}
+
+	if !cmd.Bool("no-validate") {
+		var flags lexicon.ValidateFlags = 0
+		if cmd.Bool("allow-legacy-blob") {
+			flags |= lexicon.AllowLegacyBlob
+		}
+		cat := lexicon.NewResolvingCatalog()
+		if err := lexicon.ValidateRecord(cat, newVal, nsid.String(), flags); err != nil {
+			return nil, fmt.Errorf("%s record is not valid: %w", opts.Label, err)
+		}
+	}
+
+	if opts.ShowDiff || opts.DryRun {
+		// re-marshal to normalize formatting before diff
+		compactOrig, err := json.Marshal(origVal)
+		if err != nil {
+			return nil, err
+		}
+		compactNew, err := json.Marshal(newVal)
+		if err != nil {
+			return nil, err
+		}
+		diffString, err := formatJSONDiff(compactOrig, compactNew)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("diff %s\n", aturi)
+		fmt.Println("--- current")
+		fmt.Printf("+++ %s\n", opts.Label)
+		fmt.Print(diffString)
+		fmt.Println()
+	}
+	if opts.DryRun {
+		return nil, nil
+	}
+
+	if opts.Confirm {
+		ok, err := confirmPrompt("update record?")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("update cancelled")
+		}
+	}
+
+	validate := !cmd.Bool("no-validate")
+	return agnostic.RepoPutRecord(ctx, client, &agnostic.RepoPutRecord_Input{
+		Collection: nsid.String(),
+		Repo:       aturi.Authority().String(),
+		Record:     newVal,
+		Rkey:       aturi.RecordKey().String(),
+		Validate:   &validate,
+		SwapRecord: existing.Cid,
+	})
+}
+
+func runRecordEdit(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return fmt.Errorf("expected a single AT-URI argument")
+	}
+
+	client, err := loadAuthClient(ctx, cmd)
+	if err == ErrNoAuthSession {
+		return fmt.Errorf("auth required, but not logged in")
+	} else if err != nil {
+		return err
+	}
+
+	aturi, err := parseOwnRecordURI(ctx, cmd, client, cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	existing, origVal, err := fetchOwnRecord(ctx, client, aturi)
+	if err != nil {
+		return err
+	}
+	origJSON, err := json.MarshalIndent(origVal, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "goat-record-*.json")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(append(origJSON, '\n'))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := runEditor(tmpPath); err != nil {
+		return err
+	}
+	editedJSON, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	// from here on, keep the temporary file around on errors, so edits are not lost
+	editedVal, err := atdata.UnmarshalJSON(editedJSON)
+	if err != nil {
+		return fmt.Errorf("edited record is not valid JSON (saved at %s): %w", tmpPath, err)
+	}
+	resp, err := putRecordChecked(ctx, cmd, client, aturi, existing, editedVal, recordPutOptions{
+		Label:    "edited",
+		ShowDiff: true,
+		Confirm:  !cmd.Bool("yes"),
+	})
+	if err == errRecordUnchanged {
+		os.Remove(tmpPath)
+		fmt.Println("no changes")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w (edited record saved at %s)", err, tmpPath)
+	}
+	os.Remove(tmpPath)
+
+	fmt.Printf("%s\t%s\n", resp.Uri, resp.Cid)
+	return nil
+}
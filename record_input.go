@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// picks the record input format from file extension, or by sniffing the data (for stdin or unknown extensions)
+func detectRecordFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".cbor":
+		return "cbor"
+	}
+	if len(data) > 0 && data[0] >= 0xa0 && data[0] <= 0xbf {
+		// CBOR map (major type 5)
+		return "cbor"
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] == '{' {
+		return "json"
+	}
+	return "yaml"
+}
+
+// parses record data in JSON, YAML, or DAG-CBOR format into atproto data model. YAML is interpreted with the same conventions as JSON (eg, '$bytes' and '$link' objects)
+func parseRecordInput(data []byte, format string) (map[string]any, error) {
+	switch format {
+	case "json":
+		return atdata.UnmarshalJSON(data)
+	case "yaml":
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		if _, ok := raw.(map[string]any); !ok {
+			return nil, fmt.Errorf("YAML record must be a mapping with string keys")
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("YAML record can not be represented as atproto data: %w", err)
+		}
+		return atdata.UnmarshalJSON(b)
+	case "cbor":
+		return atdata.UnmarshalCBOR(data)
+	default:
+		return nil, fmt.Errorf("unknown record format: %s", format)
+	}
+}
+
+// returns the '$type' of a parsed record
+func recordType(val map[string]any) (string, error) {
+	nsid, ok := val["$type"].(string)
+	if !ok || nsid == "" {
+		return "", fmt.Errorf("failed to parse '$type' from record data: empty or undefined")
+	}
+	return nsid, nil
+}
+
+// Fills in record templates: '{{now}}' string values are replaced with the current datetime, and '{{tid}}' with a new TID. Also sets 'createdAt' if missing.
+type recordTemplater struct {
+	clock *syntax.TIDClock
+}
+
+func newRecordTemplater() *recordTemplater {
+	return &recordTemplater{clock: syntax.NewTIDClock(0)}
+}
+
+func (rt *recordTemplater) NextTID() syntax.TID {
+	return rt.clock.Next()
+}
+
+func (rt *recordTemplater) Apply(val map[string]any) {
+	now := syntax.DatetimeNow().String()
+	if _, ok := val["createdAt"]; !ok {
+		val["createdAt"] = now
+	}
+	rt.fill(val, now)
+}
+
+func (rt *recordTemplater) fill(val any, now string) any {
+	switch v := val.(type) {
+	case map[string]any:
+		for k, elem := range v {
+			v[k] = rt.fill(elem, now)
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = rt.fill(elem, now)
+		}
+	case string:
+		switch v {
+		case "{{now}}":
+			return now
+		case "{{tid}}":
+			return rt.NextTID().String()
+		}
+	}
+	return val
+}
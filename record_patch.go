@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/atproto/atdata"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/urfave/cli/v3"
+)
+
+var cmdRecordPatch = &cli.Command{
+	Name:        "patch",
+	Usage:       "update an existing record with a JSON Patch or merge patch",
+	Description: "Fetches a record from the current account, applies a patch to the current value, validates against the Lexicon schema, and writes the result.\nThe patch can be an RFC 6902 JSON Patch (an array of operations) or an RFC 7396 JSON merge patch (an object); by default the type is detected from the patch itself.\nThe update is conditional on the original record CID, so concurrent changes are detected.",
+	ArgsUsage:   `<at-uri> [<patch-file>|-]`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "patch",
+			Usage: "patch JSON as a string, instead of a file argument",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "auto",
+			Usage: "patch format: auto, json-patch (RFC 6902), or merge-patch (RFC 7396)",
+		},
+		&cli.BoolFlag{
+			Name:    "no-validate",
+			Aliases: []string{"n"},
+			Usage:   "skip local Lexicon validation, and tell PDS not to validate",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-legacy-blob",
+			Usage: "be permissive of legacy blobs during validation",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print diff of changes, without updating",
+		},
+	},
+	Action: runRecordPatch,
+}
+
+// applies an RFC 6902 or RFC 7396 patch to a JSON document. format 'auto' picks based on whether the patch is an array or object
+func applyJSONPatch(doc, patch []byte, format string) ([]byte, error) {
+	if format == "auto" {
+		trimmed := bytes.TrimSpace(patch)
+		if len(trimmed) == 0 {
+			return nil, fmt.Errorf("empty patch")
+		}
+		switch trimmed[0] {
+		case '[':
+			format = "json-patch"
+		case '{':
+			format = "merge-patch"
+		default:
+			return nil, fmt.Errorf("patch must be a JSON array (JSON Patch) or object (merge patch)")
+		}
+	}
+	switch format {
+	case "json-patch":
+		p, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON Patch: %w", err)
+		}
+		return p.Apply(doc)
+	case "merge-patch":
+		return jsonpatch.MergePatch(doc, patch)
+	default:
+		return nil, fmt.Errorf("unknown patch format: %s", format)
+	}
+}
+
+func runRecordPatch(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() < 1 {
+		return fmt.Errorf("expected an AT-URI argument")
+	}
+
+	var patchBytes []byte
+	if cmd.String("patch") != "" {
+		if cmd.Args().Len() > 1 {
+			return fmt.Errorf("can not provide both '--patch' and a patch file")
+		}
+		patchBytes = []byte(cmd.String("patch"))
+	} else {
+		if cmd.Args().Len() != 2 {
+			return fmt.Errorf("need to provide patch file path or '-' for stdin, or '--patch'")
+		}
+		r, err := getFileOrStdin(cmd.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		patchBytes, err = io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+	}
+	if len(bytes.TrimSpace(patchBytes)) == 0 {
+		return fmt.Errorf("empty patch")
+	}
+
+	client, err := loadAuthClient(ctx, cmd)
+	if err == ErrNoAuthSession {
+		return fmt.Errorf("auth required, but not logged in")
+	} else if err != nil {
+		return err
+	}
+
+	aturi, err := parseOwnRecordURI(ctx, cmd, client, cmd.Args().First())
+	if err != nil {
+		return err
+	}
+	existing, _, err := fetchOwnRecord(ctx, client, aturi)
+	if err != nil {
+		return err
+	}
+
+	patchedJSON, err := applyJSONPatch(*existing.Value, patchBytes, cmd.String("format"))
+	if err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+	patchedVal, err := atdata.UnmarshalJSON(patchedJSON)
+	if err != nil {
+		return fmt.Errorf("patched record is not valid data: %w", err)
+	}
+	resp, err := putRecordChecked(ctx, cmd, client, aturi, existing, patchedVal, recordPutOptions{
+		Label:  "patched",
+		DryRun: cmd.Bool("dry-run"),
+	})
+	if err == errRecordUnchanged {
+		fmt.Println("no changes")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if resp == nil {
+		// dry run
+		return nil
+	}
+
+	fmt.Printf("%s\t%s\n", resp.Uri, resp.Cid)
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+)
+
+// a reference to another record, found somewhere in a record value
+type recordRef struct {
+	// JSON path within the referencing record (eg, 'reply.parent')
+	Path string
+	URI  string
+	// only set for strongRefs
+	CID string
+}
+
+// one record in the output of 'goat get --follow-refs'
+type refNode struct {
+	recordOutput
+	Parent      string `json:"parent,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Depth       int    `json:"depth"`
+	ExpectedCID string `json:"expectedCid,omitempty"`
+	CIDMatch    *bool  `json:"cidMatch,omitempty"`
+	// record was already included elsewhere in the output, and is not repeated
+	Seen bool       `json:"seen,omitempty"`
+	Refs []*refNode `json:"refs,omitempty"`
+}
+
+// finds strongRef objects ('uri' and 'cid' fields) and bare AT-URI strings which point to a specific record
+func findRecordRefs(val any, path string) []recordRef {
+	refs := []recordRef{}
+	switch v := val.(type) {
+	case map[string]any:
+		uri, uriOK := v["uri"].(string)
+		cid, cidOK := v["cid"].(string)
+		if uriOK && cidOK && isRecordURI(uri) {
+			refs = append(refs, recordRef{Path: path, URI: uri, CID: cid})
+			return refs
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			refs = append(refs, findRecordRefs(v[k], joinRefPath(path, k))...)
+		}
+	case []any:
+		for i, elem := range v {
+			refs = append(refs, findRecordRefs(elem, joinRefPath(path, strconv.Itoa(i)))...)
+		}
+	case string:
+		if isRecordURI(v) {
+			refs = append(refs, recordRef{Path: path, URI: v})
+		}
+	}
+	return refs
+}
+
+func joinRefPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// AT-URIs with a collection and record key (not accounts or collections)
+func isRecordURI(s string) bool {
+	if !strings.HasPrefix(s, "at://") {
+		return false
+	}
+	aturi, err := syntax.ParseATURI(s)
+	return err == nil && aturi.Collection() != "" && aturi.RecordKey() != ""
+}
+
+type refWalker struct {
+	Dir       identity.Directory
+	Verify    bool
+	CheckCIDs bool
+	MaxDepth  int
+
+	clients    map[string]*atclient.APIClient
+	seen       map[string]bool
+	failed     int
+	mismatched int
+}
+
+func (w *refWalker) walk(ctx context.Context, node *refNode) {
+	if w.seen[node.URI] {
+		node.Seen = true
+		return
+	}
+	w.seen[node.URI] = true
+
+	if err := fetchRecordOutput(ctx, w.Dir, w.clients, &node.recordOutput, w.Verify); err != nil {
+		node.Error = err.Error()
+		w.failed++
+		return
+	}
+	// URI is normalized to DID authority after fetching
+	w.seen[node.URI] = true
+
+	if w.CheckCIDs && node.ExpectedCID != "" {
+		match := node.ExpectedCID == node.CID
+		node.CIDMatch = &match
+		if !match {
+			w.mismatched++
+		}
+	}
+
+	if node.Depth >= w.MaxDepth || node.Value == nil {
+		return
+	}
+	var val any
+	if err := json.Unmarshal(*node.Value, &val); err != nil {
+		return
+	}
+	for _, ref := range findRecordRefs(val, "") {
+		child := &refNode{
+			recordOutput: recordOutput{URI: ref.URI},
+			Parent:       node.URI,
+			Path:         ref.Path,
+			Depth:        node.Depth + 1,
+			ExpectedCID:  ref.CID,
+		}
+		w.walk(ctx, child)
+		node.Refs = append(node.Refs, child)
+	}
+}
+
+// prints nodes in the order they were fetched, one per line, without nesting
+func printRefNodesFlat(node *refNode) error {
+	refs := node.Refs
+	flat := *node
+	flat.Refs = nil
+	b, err := json.Marshal(flat)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	for _, child := range refs {
+		if err := printRefNodesFlat(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runRecordGetRefs(ctx context.Context, cmd *cli.Command, dir identity.Directory) error {
+	uris, err := readURIArgs(cmd)
+	if err != nil {
+		return err
+	}
+	maxDepth := int(cmd.Int("depth"))
+	if maxDepth < 0 {
+		return fmt.Errorf("depth must not be negative")
+	}
+
+	w := refWalker{
+		Dir:       dir,
+		Verify:    cmd.Bool("verify"),
+		CheckCIDs: cmd.Bool("check-cids"),
+		MaxDepth:  maxDepth,
+		clients:   map[string]*atclient.APIClient{},
+		seen:      map[string]bool{},
+	}
+	for _, raw := range uris {
+		root := &refNode{recordOutput: recordOutput{URI: raw}}
+		w.walk(ctx, root)
+
+		if cmd.Bool("ndjson") {
+			err = printRefNodesFlat(root)
+		} else {
+			var b []byte
+			// a single graph is indented for reading; multiple graphs are printed one per line
+			if len(uris) == 1 {
+				b, err = json.MarshalIndent(root, "", "  ")
+			} else {
+				b, err = json.Marshal(root)
+			}
+			if err == nil {
+				fmt.Println(string(b))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.failed > 0 {
+		return fmt.Errorf("failed to fetch %d records", w.failed)
+	}
+	if w.mismatched > 0 {
+		return fmt.Errorf("%d strongRef CIDs did not match current record", w.mismatched)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/ipfs/go-cid"
+)
+
+// A record which has been verified against a signed repo commit.
+type verifiedRecord struct {
+	CID       cid.Cid
+	Value     map[string]any
+	Commit    *repo.Commit
+	CommitCID cid.Cid
+}
+
+// Fetches a record with an inclusion proof (com.atproto.sync.getRecord), and verifies it:
+//
+//   - every block in the proof CAR hashes to its CID
+//   - the commit is for the expected DID, and signed by the DID's current atproto signing key
+//   - the MST path from the commit data root leads to the record
+//
+// This does not trust the host serving the record.
+func fetchVerifiedRecord(ctx context.Context, c *atclient.APIClient, ident *identity.Identity, aturi syntax.ATURI) (*verifiedRecord, error) {
+	pub, err := ident.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("identity signing key: %w", err)
+	}
+
+	carBytes, err := comatproto.SyncGetRecord(ctx, c, aturi.Collection().String(), ident.DID.String(), aturi.RecordKey().String())
+	if err != nil {
+		return nil, err
+	}
+	cb, err := readCARBlocks(bytes.NewReader(carBytes))
+	if err != nil {
+		return nil, fmt.Errorf("invalid record proof: %w", err)
+	}
+
+	commit, commitCID, err := cb.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("invalid record proof: %w", err)
+	}
+	if commit.DID != ident.DID.String() {
+		return nil, fmt.Errorf("record proof commit is for a different DID: %s", commit.DID)
+	}
+	if err := commit.VerifySignature(pub); err != nil {
+		return nil, fmt.Errorf("record proof commit signature is not valid: %w", err)
+	}
+
+	// the proof only includes MST nodes along the path to the record, so this is a partial tree
+	tree, err := mst.LoadTreeFromStore(ctx, cb, commit.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record proof MST: %w", err)
+	}
+	path := aturi.Collection().String() + "/" + aturi.RecordKey().String()
+	recCID, err := tree.Get([]byte(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid record proof MST: %w", err)
+	}
+	if recCID == nil {
+		return nil, fmt.Errorf("%w: %s", repo.ErrNotFound, path)
+	}
+	recBytes, ok := cb.Blocks[*recCID]
+	if !ok {
+		return nil, fmt.Errorf("record block missing from proof: %s", recCID)
+	}
+	val, err := atdata.UnmarshalCBOR(recBytes)
+	if err != nil {
+		return nil, fmt.Errorf("record was invalid data: %w", err)
+	}
+
+	return &verifiedRecord{
+		CID:       *recCID,
+		Value:     val,
+		Commit:    commit,
+		CommitCID: *commitCID,
+	}, nil
+}
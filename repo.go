@@ -1,21 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
-	comatproto "github.com/bluesky-social/indigo/api/atproto"
-	"github.com/bluesky-social/indigo/atproto/atclient"
 	"github.com/bluesky-social/indigo/atproto/atdata"
 	"github.com/bluesky-social/indigo/atproto/repo"
 	"github.com/bluesky-social/indigo/atproto/syntax"
-	"github.com/bluesky-social/indigo/util"
 
 	"github.com/ipfs/go-cid"
 	"github.com/urfave/cli/v3"
@@ -27,21 +22,40 @@ var cmdRepo = &cli.Command{
 	Flags: []cli.Flag{},
 	Commands: []*cli.Command{
 		&cli.Command{
-			Name:      "export",
-			Usage:     "download CAR file for given account",
-			ArgsUsage: `<at-identifier>`,
+			Name:        "export",
+			Usage:       "download CAR file for given account",
+			Description: "The CAR file is streamed to disk, with interrupted downloads retried; partial downloads are kept as '<output>.partial', and re-running with the same '--output' resumes them (if the server supports conditional range requests, and the repo has not changed).\nWith '--since', downloads only blocks changed since the given revision (a partial CAR file).\nWith '--update', fetches changes since the revision in an existing CAR file, merges them, verifies the new commit signature, and re-writes the CAR file with the complete current repo. The account argument is optional in this mode.",
+			ArgsUsage:   `<at-identifier>`,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:    "output",
 					Aliases: []string{"o"},
 					Usage:   "file path for CAR download",
 				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "only export changes since this repo revision (TID)",
+				},
+				&cli.StringFlag{
+					Name:  "update",
+					Usage: "path to existing CAR file to update incrementally",
+				},
+				&cli.IntFlag{
+					Name:  "retries",
+					Value: 5,
+					Usage: "number of times to retry (resuming if possible) when the download is interrupted",
+				},
+				&cli.DurationFlag{
+					Name:  "idle-timeout",
+					Value: 2 * time.Minute,
+					Usage: "abort and retry the download if no data is received for this long (0 for no idle timeout)",
+				},
 			},
 			Action: runRepoExport,
 		},
 		&cli.Command{
 			Name:      "import",
-			Usage:     "upload CAR file for current account",
+			Usage:     "upload CAR file for current account (streamed from disk)",
 			ArgsUsage: `<path>`,
 			Action:    runRepoImport,
 		},
@@ -91,55 +105,65 @@ var cmdRepo = &cli.Command{
 			},
 			Action: runRepoUnpack,
 		},
+		cmdRepoPack,
+		cmdRepoDiff,
+		cmdRepoVerify,
+		cmdRepoStats,
+		cmdRepoExportSQLite,
 	},
 }
 
 func runRepoExport(ctx context.Context, cmd *cli.Command) error {
+	if cmd.String("update") != "" {
+		if cmd.String("since") != "" {
+			return fmt.Errorf("can not use '--since' with '--update' (revision is read from existing CAR file)")
+		}
+		return runRepoExportUpdate(ctx, cmd)
+	}
 	username := cmd.Args().First()
 	if username == "" {
 		return fmt.Errorf("need to provide username as an argument")
 	}
+	if cmd.Duration("idle-timeout") < 0 {
+		return fmt.Errorf("'--idle-timeout' can not be negative")
+	}
+	since := cmd.String("since")
+	if since != "" {
+		if _, err := syntax.ParseTID(since); err != nil {
+			return fmt.Errorf("invalid repo revision: %w", err)
+		}
+	}
 	ident, err := resolveIdent(ctx, cmd, username)
 	if err != nil {
 		return err
 	}
 
 	// create a new API client to connect to the account's PDS
-	c := atclient.NewAPIClient(ident.PDSEndpoint())
-	c.Headers.Set("User-Agent", userAgentString())
-	if c.Host == "" {
-		return fmt.Errorf("no PDS endpoint for identity")
+	c, err := repoSyncClient(ident)
+	if err != nil {
+		return err
 	}
 
-	// set longer timeout, for large CAR files
-	c.Client = util.RobustHTTPClient()
-	c.Client.Timeout = 600 * time.Second
-
 	carPath := cmd.String("output")
 	if carPath == "" {
 		// NOTE: having the rev in the the path might be nice
 		now := time.Now().Format("20060102150405")
 		carPath = fmt.Sprintf("%s.%s.car", username, now)
 	}
-	output, err := getFileOrStdout(carPath)
-	if err != nil {
-		if errors.Is(err, os.ErrExist) {
-			return fmt.Errorf("file already exists: %s", carPath)
-		}
-		return err
+	// stream straight to disk, with a long idle timeout instead of a total request timeout
+	c.Client.Timeout = 0
+	dl := repoDownload{
+		Client:      c,
+		DID:         ident.DID,
+		Since:       since,
+		Retries:     int(cmd.Int("retries")),
+		IdleTimeout: cmd.Duration("idle-timeout"),
 	}
-	defer output.Close()
-	if carPath != stdIOPath {
-		fmt.Printf("downloading from %s to: %s\n", c.Host, carPath)
+	if carPath == stdIOPath {
+		return dl.ToWriter(ctx, os.Stdout)
 	}
-	repoBytes, err := comatproto.SyncGetRepo(ctx, c, ident.DID.String(), "")
-	if err != nil {
-		return err
-	}
-	if _, err := output.Write(repoBytes); err != nil {
-		return err
-	}
-	return nil
+	fmt.Printf("downloading from %s to: %s\n", c.Host, carPath)
+	return dl.ToFile(ctx, carPath)
 }
 
 func runRepoImport(ctx context.Context, cmd *cli.Command) error {
@@ -156,12 +180,7 @@ func runRepoImport(ctx context.Context, cmd *cli.Command) error {
 		return err
 	}
 
-	fileBytes, err := os.ReadFile(carPath)
-	if err != nil {
-		return err
-	}
-
-	err = comatproto.RepoImportRepo(ctx, client, bytes.NewReader(fileBytes))
+	err = uploadRepoCAR(ctx, client, carPath)
 	if err != nil {
 		return fmt.Errorf("failed to import repo: %w", err)
 	}
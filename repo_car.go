@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+// In-memory set of blocks read from a CAR file, with each block's hash checked against its CID.
+//
+// Unlike the SDK blockstore, this keeps track of block order, so callers can check for missing or extra blocks.
+type carBlocks struct {
+	Roots  []cid.Cid
+	Blocks map[cid.Cid][]byte
+	Order  []cid.Cid
+}
+
+// reads all blocks from a CAR file. fails if any block data does not hash to its CID
+func readCARBlocks(r io.Reader) (*carBlocks, error) {
+	cb := carBlocks{
+		Blocks: map[cid.Cid][]byte{},
+	}
+	roots, err := iterCARBlocks(r, func(c cid.Cid, data []byte) error {
+		cb.Put(c, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cb.Roots = roots
+	return &cb, nil
+}
+
+// streams blocks from a CAR file to a callback, without holding the whole file in memory. fails if any block data does not hash to its CID
+func iterCARBlocks(r io.Reader, f func(c cid.Cid, data []byte) error) ([]cid.Cid, error) {
+	cr, err := car.NewCarReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Header.Version != 1 {
+		return nil, fmt.Errorf("unsupported CAR file version: %d", cr.Header.Version)
+	}
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		computed, err := blk.Cid().Prefix().Sum(blk.RawData())
+		if err != nil {
+			return nil, err
+		}
+		if !computed.Equals(blk.Cid()) {
+			return nil, fmt.Errorf("block data does not match CID: %s", blk.Cid())
+		}
+		if err := f(blk.Cid(), blk.RawData()); err != nil {
+			return nil, err
+		}
+	}
+	return cr.Header.Roots, nil
+}
+
+// implements repo.RepoBlockSource and mst.MSTBlockSource
+func (cb *carBlocks) Get(_ context.Context, c cid.Cid) (blocks.Block, error) {
+	b, ok := cb.Blocks[c]
+	if !ok {
+		return nil, &ipld.ErrNotFound{Cid: c}
+	}
+	return blocks.NewBlockWithCid(b, c)
+}
+
+// parses the commit object from the first root block
+func (cb *carBlocks) Commit() (*repo.Commit, *cid.Cid, error) {
+	if len(cb.Roots) < 1 {
+		return nil, nil, repo.ErrNoRoot
+	}
+	commitCID := cb.Roots[0]
+	b, ok := cb.Blocks[commitCID]
+	if !ok {
+		return nil, nil, repo.ErrNoCommit
+	}
+	var commit repo.Commit
+	if err := commit.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return nil, nil, fmt.Errorf("parsing commit block: %w", err)
+	}
+	if err := commit.VerifyStructure(); err != nil {
+		return nil, nil, fmt.Errorf("invalid commit: %w", err)
+	}
+	return &commit, &commitCID, nil
+}
+
+// Walks the repo tree from a commit, and returns the CIDs of all reachable blocks (commit, MST nodes, and records), in pre-order. Fails if any block is missing.
+func (cb *carBlocks) RepoBlockOrder(commitCID cid.Cid) ([]cid.Cid, error) {
+	b, ok := cb.Blocks[commitCID]
+	if !ok {
+		return nil, repo.ErrNoCommit
+	}
+	var commit repo.Commit
+	if err := commit.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("parsing commit block: %w", err)
+	}
+
+	order := []cid.Cid{commitCID}
+	seen := map[cid.Cid]bool{commitCID: true}
+	add := func(c cid.Cid) error {
+		if seen[c] {
+			return nil
+		}
+		if _, ok := cb.Blocks[c]; !ok {
+			return fmt.Errorf("missing block: %s", c)
+		}
+		seen[c] = true
+		order = append(order, c)
+		return nil
+	}
+
+	var walkNode func(c cid.Cid) error
+	walkNode = func(c cid.Cid) error {
+		if err := add(c); err != nil {
+			return err
+		}
+		nd, err := mst.NodeDataFromCBOR(bytes.NewReader(cb.Blocks[c]))
+		if err != nil {
+			return fmt.Errorf("parsing MST node %s: %w", c, err)
+		}
+		if nd.Left != nil {
+			if err := walkNode(*nd.Left); err != nil {
+				return err
+			}
+		}
+		for _, e := range nd.Entries {
+			if err := add(e.Value); err != nil {
+				return err
+			}
+			if e.Right != nil {
+				if err := walkNode(*e.Right); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walkNode(commit.Data); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// writes a CAR v1 file with a single root, containing the given blocks in order
+func (cb *carBlocks) WriteCAR(w io.Writer, root cid.Cid, order []cid.Cid) error {
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w); err != nil {
+		return err
+	}
+	for _, c := range order {
+		b, ok := cb.Blocks[c]
+		if !ok {
+			return fmt.Errorf("missing block: %s", c)
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adds a block to the set, if not already present
+func (cb *carBlocks) Put(c cid.Cid, data []byte) {
+	if _, ok := cb.Blocks[c]; !ok {
+		cb.Order = append(cb.Order, c)
+	}
+	cb.Blocks[c] = data
+}
+
+// encodes all nodes of an in-memory MST and adds them as blocks. returns the root CID
+func (cb *carBlocks) PutTree(tree *mst.Tree) (*cid.Cid, error) {
+	root, err := tree.RootCID()
+	if err != nil {
+		return nil, err
+	}
+	var putNode func(n *mst.Node) error
+	putNode = func(n *mst.Node) error {
+		for _, e := range n.Entries {
+			if e.ChildCID != nil && e.Child == nil {
+				return mst.ErrPartialTree
+			}
+			if e.Child != nil {
+				if err := putNode(e.Child); err != nil {
+					return err
+				}
+			}
+		}
+		nd := n.NodeData()
+		b, c, err := nd.Bytes()
+		if err != nil {
+			return err
+		}
+		cb.Put(*c, b)
+		return nil
+	}
+	if err := putNode(tree.Root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// reconstructs the full keys of an MST node's entries from prefix compression
+func decodeNodeKeys(nd *mst.NodeData) ([][]byte, error) {
+	keys := make([][]byte, len(nd.Entries))
+	prev := []byte{}
+	for i, e := range nd.Entries {
+		if int(e.PrefixLen) > len(prev) {
+			return nil, fmt.Errorf("key prefix length longer than previous key")
+		}
+		key := append(append([]byte{}, prev[:e.PrefixLen]...), e.KeySuffix...)
+		keys[i] = key
+		prev = key
+	}
+	return keys, nil
+}
+
+// Checks that a CAR file contains a complete repo: a valid commit as the root, and every MST node and record reachable from it.
+//
+// Unlike readCARBlocks and RepoBlockOrder, blocks are streamed and only CIDs and MST links are kept in memory, so this works for large repos. Blocks may be in any order.
+func checkRepoCAR(r io.ReadSeeker) error {
+	hdr, err := car.ReadHeader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	if len(hdr.Roots) < 1 {
+		return repo.ErrNoRoot
+	}
+	commitCID := hdr.Roots[0]
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	type nodeLinks struct {
+		Children []cid.Cid
+		Records  []cid.Cid
+	}
+	seen := map[cid.Cid]bool{}
+	// links for every block which parses as a non-empty MST node. records are not distinguished from nodes until the tree is walked
+	nodes := map[cid.Cid]*nodeLinks{}
+	var commit *repo.Commit
+	_, err = iterCARBlocks(bufio.NewReader(r), func(c cid.Cid, data []byte) error {
+		seen[c] = true
+		if c == commitCID {
+			commit = &repo.Commit{}
+			if err := commit.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+				return fmt.Errorf("parsing commit block: %w", err)
+			}
+			return commit.VerifyStructure()
+		}
+		if c.Prefix().Codec != cid.DagCBOR {
+			return nil
+		}
+		nd, err := mst.NodeDataFromCBOR(bytes.NewReader(data))
+		if err != nil || (nd.Left == nil && len(nd.Entries) == 0) {
+			return nil
+		}
+		links := &nodeLinks{}
+		if nd.Left != nil {
+			links.Children = append(links.Children, *nd.Left)
+		}
+		for _, e := range nd.Entries {
+			links.Records = append(links.Records, e.Value)
+			if e.Right != nil {
+				links.Children = append(links.Children, *e.Right)
+			}
+		}
+		nodes[c] = links
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if commit == nil {
+		return repo.ErrNoCommit
+	}
+
+	// only the root node can be empty (for an empty repo)
+	if !seen[commit.Data] {
+		return fmt.Errorf("missing block: %s", commit.Data)
+	}
+	stack := []cid.Cid{commit.Data}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		links := nodes[c]
+		if links == nil {
+			if c != commit.Data {
+				return fmt.Errorf("invalid or empty MST node: %s", c)
+			}
+			continue
+		}
+		// a valid tree has no shared nodes, but don't walk them more than once anyway
+		nodes[c] = &nodeLinks{}
+		for _, rc := range links.Records {
+			if !seen[rc] {
+				return fmt.Errorf("missing block: %s", rc)
+			}
+		}
+		for _, child := range links.Children {
+			if !seen[child] {
+				return fmt.Errorf("missing block: %s", child)
+			}
+			stack = append(stack, child)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v3"
+)
+
+var cmdRepoDiff = &cli.Command{
+	Name:      "diff",
+	Usage:     "compare records in two CAR files for the same account",
+	ArgsUsage: `<old-car> <new-car>`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "values",
+			Usage: "show diffs of updated record values (or include values in JSON output)",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print output as JSON",
+		},
+	},
+	Action: runRepoDiff,
+}
+
+// a repo CAR file loaded in to memory, with record paths from the MST
+type loadedRepo struct {
+	Blocks    *carBlocks
+	Commit    *repo.Commit
+	CommitCID cid.Cid
+	Records   map[string]cid.Cid
+}
+
+func loadRepoCAR(ctx context.Context, carPath string) (*loadedRepo, error) {
+	fi, err := os.Open(carPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	cb, err := readCARBlocks(bufio.NewReader(fi))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR file %s: %w", carPath, err)
+	}
+	commit, commitCID, err := cb.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", carPath, err)
+	}
+	tree, err := mst.LoadTreeFromStore(ctx, cb, commit.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to load MST: %w", carPath, err)
+	}
+	if tree.IsPartial() {
+		return nil, fmt.Errorf("%s: repo MST is incomplete (partial CAR file?)", carPath)
+	}
+	records := map[string]cid.Cid{}
+	if err := tree.WriteToMap(records); err != nil {
+		return nil, err
+	}
+	return &loadedRepo{
+		Blocks:    cb,
+		Commit:    commit,
+		CommitCID: *commitCID,
+		Records:   records,
+	}, nil
+}
+
+// returns a record as JSON, or nil if the block is not available
+func (lr *loadedRepo) recordJSON(c cid.Cid) json.RawMessage {
+	b, ok := lr.Blocks.Blocks[c]
+	if !ok {
+		return nil
+	}
+	val, err := atdata.UnmarshalCBOR(b)
+	if err != nil {
+		return nil
+	}
+	out, err := json.Marshal(val)
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+type repoDiffCommit struct {
+	Commit string `json:"commit"`
+	Rev    string `json:"rev"`
+	Data   string `json:"data"`
+}
+
+type repoDiffChange struct {
+	Action    string          `json:"action"`
+	Path      string          `json:"path"`
+	CID       string          `json:"cid,omitempty"`
+	PrevCID   string          `json:"prevCid,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	PrevValue json.RawMessage `json:"prevValue,omitempty"`
+}
+
+type repoDiffOutput struct {
+	DID     string           `json:"did"`
+	Old     repoDiffCommit   `json:"old"`
+	New     repoDiffCommit   `json:"new"`
+	Changes []repoDiffChange `json:"changes"`
+}
+
+func runRepoDiff(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 2 {
+		return fmt.Errorf("need to provide paths to two CAR files as arguments")
+	}
+	oldRepo, err := loadRepoCAR(ctx, cmd.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	newRepo, err := loadRepoCAR(ctx, cmd.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	if oldRepo.Commit.DID != newRepo.Commit.DID {
+		return fmt.Errorf("CAR files are for different accounts: %s, %s", oldRepo.Commit.DID, newRepo.Commit.DID)
+	}
+
+	paths := []string{}
+	for k := range oldRepo.Records {
+		paths = append(paths, k)
+	}
+	for k := range newRepo.Records {
+		if _, ok := oldRepo.Records[k]; !ok {
+			paths = append(paths, k)
+		}
+	}
+	sort.Strings(paths)
+
+	withValues := cmd.Bool("values")
+	out := repoDiffOutput{
+		DID:     newRepo.Commit.DID,
+		Old:     repoDiffCommit{Commit: oldRepo.CommitCID.String(), Rev: oldRepo.Commit.Rev, Data: oldRepo.Commit.Data.String()},
+		New:     repoDiffCommit{Commit: newRepo.CommitCID.String(), Rev: newRepo.Commit.Rev, Data: newRepo.Commit.Data.String()},
+		Changes: []repoDiffChange{},
+	}
+	for _, p := range paths {
+		oldCID, inOld := oldRepo.Records[p]
+		newCID, inNew := newRepo.Records[p]
+		var ch repoDiffChange
+		switch {
+		case inOld && !inNew:
+			ch = repoDiffChange{Action: "delete", Path: p, PrevCID: oldCID.String()}
+		case !inOld && inNew:
+			ch = repoDiffChange{Action: "create", Path: p, CID: newCID.String()}
+		case !oldCID.Equals(newCID):
+			ch = repoDiffChange{Action: "update", Path: p, CID: newCID.String(), PrevCID: oldCID.String()}
+		default:
+			continue
+		}
+		if withValues {
+			if inOld {
+				ch.PrevValue = oldRepo.recordJSON(oldCID)
+			}
+			if inNew {
+				ch.Value = newRepo.recordJSON(newCID)
+			}
+		}
+		out.Changes = append(out.Changes, ch)
+	}
+
+	if cmd.Bool("json") {
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("DID: %s\n", out.DID)
+	fmt.Printf("Revision: %s -> %s\n", out.Old.Rev, out.New.Rev)
+	fmt.Printf("Commit CID: %s -> %s\n", out.Old.Commit, out.New.Commit)
+	fmt.Printf("Data CID: %s -> %s\n", out.Old.Data, out.New.Data)
+	fmt.Println()
+	counts := map[string]int{}
+	for _, ch := range out.Changes {
+		counts[ch.Action]++
+		switch ch.Action {
+		case "create":
+			fmt.Printf("created\t%s\t%s\n", ch.Path, ch.CID)
+		case "update":
+			fmt.Printf("updated\t%s\t%s -> %s\n", ch.Path, ch.PrevCID, ch.CID)
+		case "delete":
+			fmt.Printf("deleted\t%s\t%s\n", ch.Path, ch.PrevCID)
+		}
+		if ch.Action == "update" && ch.PrevValue != nil && ch.Value != nil {
+			diffString, err := formatJSONDiff(ch.PrevValue, ch.Value)
+			if err != nil {
+				return err
+			}
+			fmt.Println("--- old")
+			fmt.Println("+++ new")
+			fmt.Print(diffString)
+			fmt.Println()
+		}
+	}
+	fmt.Printf("\n%d created, %d updated, %d deleted\n", counts["create"], counts["update"], counts["delete"])
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/util"
+
+	"github.com/urfave/cli/v3"
+)
+
+// creates an API client for sync requests against the account's PDS, with a long timeout for large CAR files
+func repoSyncClient(ident *identity.Identity) (*atclient.APIClient, error) {
+	if ident.PDSEndpoint() == "" {
+		return nil, fmt.Errorf("no PDS endpoint for identity")
+	}
+	c := atclient.NewAPIClient(ident.PDSEndpoint())
+	c.Headers.Set("User-Agent", userAgentString())
+	c.Client = util.RobustHTTPClient()
+	c.Client.Timeout = 600 * time.Second
+	return c, nil
+}
+
+// Updates an existing repo CAR file in place: fetches only the changes since the existing commit revision, merges blocks, verifies the new commit, and writes out a complete CAR file (without any blocks which are no longer part of the repo).
+func runRepoExportUpdate(ctx context.Context, cmd *cli.Command) error {
+	carPath := cmd.String("update")
+
+	fi, err := os.Open(carPath)
+	if err != nil {
+		return err
+	}
+	info, err := fi.Stat()
+	if err != nil {
+		fi.Close()
+		return err
+	}
+	cb, err := readCARBlocks(bufio.NewReader(fi))
+	fi.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read existing CAR file: %w", err)
+	}
+	oldCommit, _, err := cb.Commit()
+	if err != nil {
+		return fmt.Errorf("existing CAR file: %w", err)
+	}
+
+	// account defaults to the one in the existing CAR
+	username := cmd.Args().First()
+	if username == "" {
+		username = oldCommit.DID
+	}
+	ident, err := resolveIdentVerify(ctx, cmd, username)
+	if err != nil {
+		return err
+	}
+	if ident.DID.String() != oldCommit.DID {
+		return fmt.Errorf("existing CAR file is for a different account: %s", oldCommit.DID)
+	}
+	pub, err := ident.PublicKey()
+	if err != nil {
+		return fmt.Errorf("identity signing key: %w", err)
+	}
+	c, err := repoSyncClient(ident)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("fetching changes since rev %s from %s\n", oldCommit.Rev, c.Host)
+	diffBytes, err := comatproto.SyncGetRepo(ctx, c, ident.DID.String(), oldCommit.Rev)
+	if err != nil {
+		return err
+	}
+	diff, err := readCARBlocks(bytes.NewReader(diffBytes))
+	if err != nil {
+		return fmt.Errorf("invalid repo diff CAR: %w", err)
+	}
+	newCommit, newCommitCID, err := diff.Commit()
+	if err != nil {
+		return fmt.Errorf("invalid repo diff CAR: %w", err)
+	}
+	if newCommit.DID != ident.DID.String() {
+		return fmt.Errorf("repo diff commit is for a different DID: %s", newCommit.DID)
+	}
+	if err := newCommit.VerifySignature(pub); err != nil {
+		return fmt.Errorf("repo diff commit signature is not valid: %w", err)
+	}
+	if newCommit.Rev == oldCommit.Rev {
+		fmt.Println("already up to date")
+		return nil
+	}
+	if newCommit.Rev < oldCommit.Rev {
+		return fmt.Errorf("remote repo rev (%s) is older than existing CAR file (%s)", newCommit.Rev, oldCommit.Rev)
+	}
+
+	for _, blk := range diff.Order {
+		cb.Blocks[blk] = diff.Blocks[blk]
+	}
+	order, err := cb.RepoBlockOrder(*newCommitCID)
+	if err != nil {
+		return fmt.Errorf("merged repo is incomplete (a full export may be required): %w", err)
+	}
+
+	outPath := cmd.String("output")
+	if outPath == "" {
+		outPath = carPath
+	}
+	// write to a temporary file and rename, so the existing CAR file is not corrupted on failure
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), filepath.Base(outPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	if err := cb.WriteCAR(w, *newCommitCID, order); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), outPath); err != nil {
+		return err
+	}
+	fmt.Printf("updated %s: rev %s -> %s (%d new blocks, %d total)\n", outPath, oldCommit.Rev, newCommit.Rev, len(diff.Order), len(order))
+	return nil
+}
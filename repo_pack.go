@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/repo"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/urfave/cli/v3"
+)
+
+var cmdRepoPack = &cli.Command{
+	Name:        "pack",
+	Usage:       "build a signed CAR file from a directory of JSON record files",
+	Description: "The inverse of 'goat repo unpack': reads '<collection>/<rkey>.json' record files from the directory, encodes them as DAG-CBOR, builds the MST, and writes a CAR file with a new commit signed by the provided key.\nThe account DID is read from '_commit.json' in the directory (as written by unpack), unless '--did' is provided. A new revision (TID) is generated for the commit.\nThe resulting CAR file can be uploaded with 'goat repo import'. The signing key should be the account's current atproto signing key, or the commit will not verify.",
+	ArgsUsage:   `<directory>`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "signing-key",
+			Required: true,
+			Usage:    "secret key to sign the commit (multibase syntax, '@<keystore-name>', 'file:<path>', 'env:<name>', or 'exec:<command>')",
+			Sources:  cli.EnvVars("ATPROTO_SIGNING_KEY"),
+		},
+		&cli.StringFlag{
+			Name:  "did",
+			Usage: "account DID for the commit (overrides '_commit.json')",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "file path for CAR file (default: '<did>.car')",
+		},
+	},
+	Action: runRepoPack,
+}
+
+// reads record files from an unpacked repo directory, returning record blocks keyed by repo path
+func readRepoDir(topDir string, cb *carBlocks) (map[string]cid.Cid, error) {
+	builder := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256)
+	records := map[string]cid.Cid{}
+	err := filepath.WalkDir(topDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && p != topDir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(topDir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "_commit.json" {
+			return nil
+		}
+		path := strings.TrimSuffix(filepath.ToSlash(rel), ".json")
+		collection, _, err := syntax.ParseRepoPath(path)
+		if err != nil {
+			return fmt.Errorf("record file path is not '<collection>/<rkey>.json': %s", p)
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		val, err := atdata.UnmarshalJSON(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		nsid, err := recordType(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		if nsid != collection.String() {
+			return fmt.Errorf("%s: record '$type' does not match collection: %s", p, nsid)
+		}
+		recBytes, err := atdata.MarshalCBOR(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		c, err := builder.Sum(recBytes)
+		if err != nil {
+			return err
+		}
+		cb.Put(c, recBytes)
+		records[path] = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func runRepoPack(ctx context.Context, cmd *cli.Command) error {
+	topDir := cmd.Args().First()
+	if topDir == "" {
+		return fmt.Errorf("need to provide directory path as argument")
+	}
+	priv, err := loadSigner(ctx, cmd.String("signing-key"))
+	if err != nil {
+		return err
+	}
+
+	// the old commit is only used for the DID and to check revision ordering
+	var oldCommit struct {
+		DID string `json:"did"`
+		Rev string `json:"rev"`
+	}
+	commitJSON, err := os.ReadFile(filepath.Join(topDir, "_commit.json"))
+	if err == nil {
+		if err := json.Unmarshal(commitJSON, &oldCommit); err != nil {
+			return fmt.Errorf("parsing _commit.json: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	didStr := cmd.String("did")
+	if didStr == "" {
+		didStr = oldCommit.DID
+	}
+	if didStr == "" {
+		return fmt.Errorf("no '_commit.json' in directory; account DID must be provided with '--did'")
+	}
+	did, err := syntax.ParseDID(didStr)
+	if err != nil {
+		return err
+	}
+
+	cb := &carBlocks{Blocks: map[cid.Cid][]byte{}}
+	records, err := readRepoDir(topDir, cb)
+	if err != nil {
+		return err
+	}
+	tree, err := mst.LoadTreeFromMap(records)
+	if err != nil {
+		return fmt.Errorf("building MST: %w", err)
+	}
+	dataCID, err := cb.PutTree(tree)
+	if err != nil {
+		return fmt.Errorf("encoding MST: %w", err)
+	}
+
+	rev := syntax.NewTIDClock(0).Next().String()
+	if oldCommit.Rev != "" && rev <= oldCommit.Rev {
+		return fmt.Errorf("existing commit revision is in the future: %s", oldCommit.Rev)
+	}
+	commit := repo.Commit{
+		DID:     did.String(),
+		Version: repo.ATPROTO_REPO_VERSION,
+		Data:    *dataCID,
+		Rev:     rev,
+	}
+	if err := commit.Sign(priv); err != nil {
+		return fmt.Errorf("signing commit: %w", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := commit.MarshalCBOR(buf); err != nil {
+		return err
+	}
+	commitCID, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	cb.Put(commitCID, buf.Bytes())
+
+	order, err := cb.RepoBlockOrder(commitCID)
+	if err != nil {
+		return err
+	}
+	carPath := cmd.String("output")
+	if carPath == "" {
+		carPath = did.String() + ".car"
+	}
+	if _, err := os.Stat(carPath); err == nil {
+		return fmt.Errorf("file already exists: %s", carPath)
+	}
+	f, err := os.Create(carPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if err := cb.WriteCAR(w, commitCID, order); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: %d records, rev %s, commit %s\n", carPath, len(records), rev, commitCID)
+	fmt.Printf("signed with %s\n", pub.DIDKey())
+	return nil
+}
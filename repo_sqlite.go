@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/urfave/cli/v3"
+	_ "modernc.org/sqlite"
+)
+
+var cmdRepoExportSQLite = &cli.Command{
+	Name:        "export-sqlite",
+	Usage:       "load records from CAR files in to a SQLite database",
+	Description: "Each record is stored in the 'records' table, keyed by DID, collection, and record key, with the record CID, JSON value, and 'createdAt' field (if any). Blob references are stored in the 'blobs' table, and the commit of each repo in the 'repos' table.\nThe database is created if it does not exist. Existing databases are updated in place: changed records are upserted, and records which are no longer in the repo are removed. CAR files with an older revision than the database are skipped.\nMany CAR files can be loaded at once as arguments, or with '--car-list'.",
+	ArgsUsage:   `<car-file>... <db-file>`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "car-list",
+			Usage: "file with list of CAR file paths, one per line ('-' for stdin)",
+		},
+	},
+	Action: runRepoExportSQLite,
+}
+
+const repoSQLiteSchema = `
+CREATE TABLE IF NOT EXISTS repos (
+	did TEXT PRIMARY KEY,
+	rev TEXT NOT NULL,
+	commit_cid TEXT NOT NULL,
+	data_cid TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS records (
+	did TEXT NOT NULL,
+	collection TEXT NOT NULL,
+	rkey TEXT NOT NULL,
+	cid TEXT NOT NULL,
+	created_at TEXT,
+	record TEXT NOT NULL,
+	PRIMARY KEY (did, collection, rkey)
+);
+CREATE INDEX IF NOT EXISTS records_collection_created_at ON records (collection, created_at);
+CREATE TABLE IF NOT EXISTS blobs (
+	did TEXT NOT NULL,
+	collection TEXT NOT NULL,
+	rkey TEXT NOT NULL,
+	cid TEXT NOT NULL,
+	mime_type TEXT,
+	size INTEGER,
+	PRIMARY KEY (did, collection, rkey, cid)
+);
+CREATE INDEX IF NOT EXISTS blobs_cid ON blobs (cid);
+`
+
+// reads CAR file paths from a list file, skipping blank lines
+func readCARList(path string) ([]string, error) {
+	r, err := getFileOrStdin(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func runRepoExportSQLite(ctx context.Context, cmd *cli.Command) error {
+	args := cmd.Args().Slice()
+	if len(args) < 1 {
+		return fmt.Errorf("need to provide path to database file as argument")
+	}
+	dbPath := args[len(args)-1]
+	carPaths := args[:len(args)-1]
+	if cmd.String("car-list") != "" {
+		more, err := readCARList(cmd.String("car-list"))
+		if err != nil {
+			return err
+		}
+		carPaths = append(carPaths, more...)
+	}
+	if len(carPaths) == 0 {
+		return fmt.Errorf("need to provide at least one CAR file")
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, repoSQLiteSchema); err != nil {
+		return fmt.Errorf("creating database schema: %w", err)
+	}
+
+	for _, carPath := range carPaths {
+		if err := exportRepoSQLite(ctx, db, carPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loads (or updates) a single repo in the database, in a single transaction
+func exportRepoSQLite(ctx context.Context, db *sql.DB, carPath string) error {
+	lr, err := loadRepoCAR(ctx, carPath)
+	if err != nil {
+		return err
+	}
+	did := lr.Commit.DID
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldRev string
+	err = tx.QueryRowContext(ctx, `SELECT rev FROM repos WHERE did = ?`, did).Scan(&oldRev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if oldRev != "" && oldRev > lr.Commit.Rev {
+		fmt.Printf("%s\t%s\tskipped (database has newer rev %s)\n", carPath, did, oldRev)
+		return nil
+	}
+
+	// existing record CIDs, to skip unchanged records and find deletions
+	existing := map[string]string{}
+	rows, err := tx.QueryContext(ctx, `SELECT collection, rkey, cid FROM records WHERE did = ?`, did)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var collection, rkey, c string
+		if err := rows.Scan(&collection, &rkey, &c); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[collection+"/"+rkey] = c
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	upsertRecord, err := tx.PrepareContext(ctx, `INSERT INTO records (did, collection, rkey, cid, created_at, record) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (did, collection, rkey) DO UPDATE SET cid = excluded.cid, created_at = excluded.created_at, record = excluded.record`)
+	if err != nil {
+		return err
+	}
+	defer upsertRecord.Close()
+	deleteBlobs, err := tx.PrepareContext(ctx, `DELETE FROM blobs WHERE did = ? AND collection = ? AND rkey = ?`)
+	if err != nil {
+		return err
+	}
+	defer deleteBlobs.Close()
+	insertBlob, err := tx.PrepareContext(ctx, `INSERT OR REPLACE INTO blobs (did, collection, rkey, cid, mime_type, size) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertBlob.Close()
+	deleteRecord, err := tx.PrepareContext(ctx, `DELETE FROM records WHERE did = ? AND collection = ? AND rkey = ?`)
+	if err != nil {
+		return err
+	}
+	defer deleteRecord.Close()
+
+	upserted := 0
+	for path, c := range lr.Records {
+		prevCID, ok := existing[path]
+		delete(existing, path)
+		if ok && prevCID == c.String() {
+			continue
+		}
+		collection, rkey, err := syntax.ParseRepoPath(path)
+		if err != nil {
+			return fmt.Errorf("invalid repo path %s: %w", path, err)
+		}
+		b, ok := lr.Blocks.Blocks[c]
+		if !ok {
+			return fmt.Errorf("record block missing from CAR file: %s", path)
+		}
+		val, err := atdata.UnmarshalCBOR(b)
+		if err != nil {
+			return fmt.Errorf("invalid record %s: %w", path, err)
+		}
+		recJSON, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		var createdAt any
+		if s, ok := val["createdAt"].(string); ok {
+			createdAt = s
+		}
+		if _, err := upsertRecord.ExecContext(ctx, did, collection.String(), rkey.String(), c.String(), createdAt, string(recJSON)); err != nil {
+			return err
+		}
+		if _, err := deleteBlobs.ExecContext(ctx, did, collection.String(), rkey.String()); err != nil {
+			return err
+		}
+		for _, blob := range atdata.ExtractBlobs(val) {
+			if _, err := insertBlob.ExecContext(ctx, did, collection.String(), rkey.String(), blob.Ref.String(), blob.MimeType, blob.Size); err != nil {
+				return err
+			}
+		}
+		upserted++
+	}
+
+	// anything left in the existing set has been deleted from the repo
+	for path := range existing {
+		collection, rkey, _ := strings.Cut(path, "/")
+		if _, err := deleteRecord.ExecContext(ctx, did, collection, rkey); err != nil {
+			return err
+		}
+		if _, err := deleteBlobs.ExecContext(ctx, did, collection, rkey); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO repos (did, rev, commit_cid, data_cid) VALUES (?, ?, ?, ?)
+		ON CONFLICT (did) DO UPDATE SET rev = excluded.rev, commit_cid = excluded.commit_cid, data_cid = excluded.data_cid`,
+		did, lr.Commit.Rev, lr.CommitCID.String(), lr.Commit.Data.String())
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Printf("%s\t%s\t%d records (%d upserted, %d deleted)\n", carPath, did, len(lr.Records), upserted, len(existing))
+	return nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v3"
+)
+
+var cmdRepoStats = &cli.Command{
+	Name:        "stats",
+	Usage:       "summarize records, blobs, MST shape, and blocks in CAR file",
+	Description: "Reports record counts and sizes per collection, blob references (with declared sizes), MST depth and node fanout (entries per node), the oldest and newest TID record keys, and CAR block counts.\nBlob sizes are as declared in records; blobs are not included in CAR files.",
+	ArgsUsage:   `<car-file>`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print output as JSON",
+		},
+	},
+	Action: runRepoStats,
+}
+
+type repoStatsCollection struct {
+	Collection string `json:"collection"`
+	Records    int    `json:"records"`
+	Bytes      int64  `json:"bytes"`
+	BlobRefs   int    `json:"blobRefs"`
+	BlobBytes  int64  `json:"blobBytes"`
+}
+
+type repoStatsBlobs struct {
+	// total references in records, including duplicates
+	Refs int `json:"refs"`
+	// distinct blob CIDs, and sum of their declared sizes
+	Unique int   `json:"unique"`
+	Bytes  int64 `json:"bytes"`
+}
+
+type repoStatsCount struct {
+	Value int `json:"value"`
+	Count int `json:"count"`
+}
+
+type repoStatsMST struct {
+	// number of layers in the tree
+	Depth int `json:"depth"`
+	Nodes int `json:"nodes"`
+	// number of nodes at each layer, with zero at the bottom
+	Layers []repoStatsCount `json:"layers"`
+	// number of nodes with each count of entries
+	Fanout []repoStatsCount `json:"fanout"`
+}
+
+type repoStatsTID struct {
+	Path      string `json:"path"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type repoStatsBlocks struct {
+	Total       int   `json:"total"`
+	Bytes       int64 `json:"bytes"`
+	Commits     int   `json:"commits"`
+	CommitBytes int64 `json:"commitBytes"`
+	Nodes       int   `json:"mstNodes"`
+	NodeBytes   int64 `json:"mstNodeBytes"`
+	Records     int   `json:"records"`
+	RecordBytes int64 `json:"recordBytes"`
+	// blocks which are not part of the repo tree
+	Unreferenced int `json:"unreferenced"`
+	// blocks referenced by the repo tree, but not in CAR file
+	Missing int `json:"missing"`
+}
+
+type repoStats struct {
+	DID         string                `json:"did"`
+	Rev         string                `json:"rev"`
+	Commit      string                `json:"commit"`
+	Records     int                   `json:"records"`
+	RecordBytes int64                 `json:"recordBytes"`
+	Collections []repoStatsCollection `json:"collections"`
+	Blobs       repoStatsBlobs        `json:"blobs"`
+	MST         repoStatsMST          `json:"mst"`
+	OldestTID   *repoStatsTID         `json:"oldestTid,omitempty"`
+	NewestTID   *repoStatsTID         `json:"newestTid,omitempty"`
+	Blocks      repoStatsBlocks       `json:"blocks"`
+}
+
+// accumulates stats while walking the repo tree
+type repoStatsWalker struct {
+	Blocks *carBlocks
+
+	seen        map[cid.Cid]bool
+	collections map[string]*repoStatsCollection
+	blobs       map[string]int64
+	layers      map[int]int
+	fanout      map[int]int
+	oldest      syntax.TID
+	newest      syntax.TID
+	oldestPath  string
+	newestPath  string
+	out         *repoStats
+}
+
+// returns block data, counting each block only once
+func (w *repoStatsWalker) block(c cid.Cid) ([]byte, bool) {
+	if w.seen[c] {
+		return nil, false
+	}
+	w.seen[c] = true
+	b, ok := w.Blocks.Blocks[c]
+	if !ok {
+		w.out.Blocks.Missing++
+	}
+	return b, ok
+}
+
+// Walks an MST node and its subtrees. height is the expected layer of this node, or -1 for the root. Returns the layer of the node, or -1 if unknown (eg, for an empty repo or missing block).
+//
+// A node with no entries (just a pointer to a child) has no keys to derive its layer from, so it is counted one layer above its child.
+func (w *repoStatsWalker) walkNode(c cid.Cid, height int) (int, error) {
+	b, ok := w.block(c)
+	if !ok {
+		return height, nil
+	}
+	w.out.Blocks.Nodes++
+	w.out.Blocks.NodeBytes += int64(len(b))
+	nd, err := mst.NodeDataFromCBOR(bytes.NewReader(b))
+	if err != nil {
+		return height, fmt.Errorf("parsing MST node %s: %w", c, err)
+	}
+	w.fanout[len(nd.Entries)]++
+
+	keys, err := decodeNodeKeys(nd)
+	if err != nil {
+		return height, fmt.Errorf("invalid MST node %s: %w", c, err)
+	}
+	if len(keys) > 0 {
+		height = mst.HeightForKey(keys[0])
+	}
+
+	if nd.Left != nil {
+		childHeight, err := w.walkNode(*nd.Left, height-1)
+		if err != nil {
+			return height, err
+		}
+		if len(keys) == 0 && childHeight >= 0 {
+			height = childHeight + 1
+		}
+	}
+	if height >= 0 {
+		w.layers[height]++
+	}
+	for i, e := range nd.Entries {
+		w.addRecord(string(keys[i]), e.Value)
+		if e.Right != nil {
+			if _, err := w.walkNode(*e.Right, height-1); err != nil {
+				return height, err
+			}
+		}
+	}
+	return height, nil
+}
+
+func (w *repoStatsWalker) addRecord(path string, c cid.Cid) {
+	collection, rkey, err := syntax.ParseRepoPath(path)
+	if err != nil {
+		return
+	}
+	if tid, err := syntax.ParseTID(rkey.String()); err == nil {
+		if w.oldestPath == "" || tid.Integer() < w.oldest.Integer() {
+			w.oldest, w.oldestPath = tid, path
+		}
+		if w.newestPath == "" || tid.Integer() > w.newest.Integer() {
+			w.newest, w.newestPath = tid, path
+		}
+	}
+
+	col, ok := w.collections[collection.String()]
+	if !ok {
+		col = &repoStatsCollection{Collection: collection.String()}
+		w.collections[collection.String()] = col
+	}
+	col.Records++
+	w.out.Records++
+
+	// record blocks may be shared by several paths; bytes are counted for each
+	b, ok := w.Blocks.Blocks[c]
+	if !w.seen[c] {
+		w.seen[c] = true
+		if !ok {
+			w.out.Blocks.Missing++
+		} else {
+			w.out.Blocks.Records++
+			w.out.Blocks.RecordBytes += int64(len(b))
+		}
+	}
+	if !ok {
+		return
+	}
+	col.Bytes += int64(len(b))
+	w.out.RecordBytes += int64(len(b))
+
+	val, err := atdata.UnmarshalCBOR(b)
+	if err != nil {
+		return
+	}
+	for _, blob := range atdata.ExtractBlobs(val) {
+		col.BlobRefs++
+		col.BlobBytes += blob.Size
+		w.out.Blobs.Refs++
+		w.blobs[blob.Ref.String()] = blob.Size
+	}
+}
+
+// sorts a histogram map in to a list, by value
+func sortedCounts(m map[int]int) []repoStatsCount {
+	out := []repoStatsCount{}
+	for v, n := range m {
+		out = append(out, repoStatsCount{Value: v, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Value < out[j].Value })
+	return out
+}
+
+func runRepoStats(ctx context.Context, cmd *cli.Command) error {
+	carPath := cmd.Args().First()
+	if carPath == "" {
+		return fmt.Errorf("need to provide path to CAR file as argument")
+	}
+	fi, err := os.Open(carPath)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	cb, err := readCARBlocks(bufio.NewReader(fi))
+	if err != nil {
+		return fmt.Errorf("failed to read CAR file: %w", err)
+	}
+	commit, commitCID, err := cb.Commit()
+	if err != nil {
+		return err
+	}
+
+	out := repoStats{
+		DID:         commit.DID,
+		Rev:         commit.Rev,
+		Commit:      commitCID.String(),
+		Collections: []repoStatsCollection{},
+	}
+	w := repoStatsWalker{
+		Blocks:      cb,
+		seen:        map[cid.Cid]bool{*commitCID: true},
+		collections: map[string]*repoStatsCollection{},
+		blobs:       map[string]int64{},
+		layers:      map[int]int{},
+		fanout:      map[int]int{},
+		out:         &out,
+	}
+	out.Blocks.Commits = 1
+	out.Blocks.CommitBytes = int64(len(cb.Blocks[*commitCID]))
+	if _, err := w.walkNode(commit.Data, -1); err != nil {
+		return err
+	}
+
+	for _, col := range w.collections {
+		out.Collections = append(out.Collections, *col)
+	}
+	sort.Slice(out.Collections, func(i, j int) bool { return out.Collections[i].Collection < out.Collections[j].Collection })
+	out.Blobs.Unique = len(w.blobs)
+	for _, size := range w.blobs {
+		out.Blobs.Bytes += size
+	}
+	out.MST.Nodes = out.Blocks.Nodes
+	out.MST.Layers = sortedCounts(w.layers)
+	if len(out.MST.Layers) > 0 {
+		out.MST.Depth = out.MST.Layers[len(out.MST.Layers)-1].Value + 1
+	}
+	out.MST.Fanout = sortedCounts(w.fanout)
+	if w.oldestPath != "" {
+		out.OldestTID = &repoStatsTID{Path: w.oldestPath, CreatedAt: w.oldest.Time().UTC().Format(syntax.AtprotoDatetimeLayout)}
+		out.NewestTID = &repoStatsTID{Path: w.newestPath, CreatedAt: w.newest.Time().UTC().Format(syntax.AtprotoDatetimeLayout)}
+	}
+	out.Blocks.Total = len(cb.Order)
+	for _, c := range cb.Order {
+		out.Blocks.Bytes += int64(len(cb.Blocks[c]))
+		if !w.seen[c] {
+			out.Blocks.Unreferenced++
+		}
+	}
+
+	if cmd.Bool("json") {
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("DID: %s\n", out.DID)
+	fmt.Printf("Revision: %s\n", out.Rev)
+	fmt.Printf("Commit CID: %s\n", out.Commit)
+	fmt.Println()
+	fmt.Printf("Records: %d (%s)\n", out.Records, formatByteSize(out.RecordBytes))
+	for _, col := range out.Collections {
+		fmt.Printf("  %s\t%d records\t%s", col.Collection, col.Records, formatByteSize(col.Bytes))
+		if col.BlobRefs > 0 {
+			fmt.Printf("\t%d blob refs (%s)", col.BlobRefs, formatByteSize(col.BlobBytes))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("Blobs: %d refs, %d unique (%s declared)\n", out.Blobs.Refs, out.Blobs.Unique, formatByteSize(out.Blobs.Bytes))
+	if out.OldestTID != nil {
+		fmt.Printf("Oldest TID: %s\t%s\n", out.OldestTID.Path, out.OldestTID.CreatedAt)
+		fmt.Printf("Newest TID: %s\t%s\n", out.NewestTID.Path, out.NewestTID.CreatedAt)
+	}
+	fmt.Println()
+	fmt.Printf("MST: %d nodes, depth %d\n", out.MST.Nodes, out.MST.Depth)
+	for i := len(out.MST.Layers) - 1; i >= 0; i-- {
+		fmt.Printf("  layer %d\t%d nodes\n", out.MST.Layers[i].Value, out.MST.Layers[i].Count)
+	}
+	fmt.Println("Fanout (entries per node):")
+	for _, f := range out.MST.Fanout {
+		fmt.Printf("  %d\t%d nodes\n", f.Value, f.Count)
+	}
+	fmt.Println()
+	fmt.Printf("Blocks: %d (%s)\n", out.Blocks.Total, formatByteSize(out.Blocks.Bytes))
+	fmt.Printf("  commit\t%d (%s)\n", out.Blocks.Commits, formatByteSize(out.Blocks.CommitBytes))
+	fmt.Printf("  MST nodes\t%d (%s)\n", out.Blocks.Nodes, formatByteSize(out.Blocks.NodeBytes))
+	fmt.Printf("  records\t%d (%s)\n", out.Blocks.Records, formatByteSize(out.Blocks.RecordBytes))
+	if out.Blocks.Unreferenced > 0 {
+		fmt.Printf("  unreferenced\t%d\n", out.Blocks.Unreferenced)
+	}
+	if out.Blocks.Missing > 0 {
+		fmt.Printf("  missing\t%d\n", out.Blocks.Missing)
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/atclient"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/term"
+)
+
+// formats a byte count for humans (eg, "12.3 MB")
+func formatByteSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// Reports transfer progress to stderr. On a terminal the status line is updated in place; otherwise a line is printed every few seconds.
+type progressCounter struct {
+	Label string
+	// expected total bytes; zero if unknown
+	Total int64
+
+	n         int64
+	base      int64
+	start     time.Time
+	lastPrint time.Time
+	tty       bool
+}
+
+func newProgressCounter(label string, total int64) *progressCounter {
+	return &progressCounter{
+		Label: label,
+		Total: total,
+		start: time.Now(),
+		tty:   term.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+func (p *progressCounter) Add(n int) {
+	p.n += int64(n)
+	interval := 10 * time.Second
+	if p.tty {
+		interval = 250 * time.Millisecond
+	}
+	if time.Since(p.lastPrint) >= interval {
+		p.print()
+	}
+}
+
+// resets the count, eg when a download restarts from the beginning
+func (p *progressCounter) Reset(n int64) {
+	p.n = n
+	p.base = n
+	p.start = time.Now()
+}
+
+func (p *progressCounter) print() {
+	p.lastPrint = time.Now()
+	status := fmt.Sprintf("%s: %s", p.Label, formatByteSize(p.n))
+	if p.Total > 0 {
+		status += fmt.Sprintf(" of %s (%.0f%%)", formatByteSize(p.Total), float64(p.n)/float64(p.Total)*100)
+	}
+	if secs := time.Since(p.start).Seconds(); secs > 0 {
+		status += fmt.Sprintf(", %s/s", formatByteSize(int64(float64(p.n-p.base)/secs)))
+	}
+	if p.tty {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", status)
+	} else {
+		fmt.Fprintln(os.Stderr, status)
+	}
+}
+
+// prints final status
+func (p *progressCounter) Done() {
+	p.print()
+	if p.tty {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// counts bytes read through to a progressCounter. seeking (for request retries) resets the count
+type progressReader struct {
+	R io.ReadSeeker
+	P *progressCounter
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.R.Read(b)
+	pr.P.Add(n)
+	return n, err
+}
+
+func (pr *progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := pr.R.Seek(offset, whence)
+	if err == nil {
+		pr.P.Reset(pos)
+	}
+	return pos, err
+}
+
+// cancels a context if no data is read for the timeout period; used to detect stalled downloads
+type idleTimeoutReader struct {
+	R     io.Reader
+	Timer *time.Timer
+	Idle  time.Duration
+}
+
+func (ir *idleTimeoutReader) Read(b []byte) (int, error) {
+	n, err := ir.R.Read(b)
+	ir.Timer.Reset(ir.Idle)
+	return n, err
+}
+
+// errors which should not be retried (eg, account not found)
+var errRepoDownloadFatal = errors.New("repo download failed")
+
+// Downloads a repo CAR file (com.atproto.sync.getRepo) as a stream, writing directly to disk. Interrupted downloads are retried, resuming with a conditional HTTP range request ('If-Range') if the server supports it, and restarting otherwise.
+type repoDownload struct {
+	Client *atclient.APIClient
+	DID    syntax.DID
+	// optional repo revision, for partial exports
+	Since       string
+	Retries     int
+	IdleTimeout time.Duration
+
+	// validator ('ETag' or 'Last-Modified') of the response being downloaded; resuming is only possible if this is known
+	validator string
+	// optional path to persist download state, so partial downloads can be resumed by later runs
+	statePath string
+}
+
+// download state kept next to a partial download file
+type repoDownloadState struct {
+	DID       string `json:"did"`
+	Since     string `json:"since,omitempty"`
+	Validator string `json:"validator"`
+}
+
+// returns a validator for the response which can be used with 'If-Range', or an empty string. weak ETags can not be used for range requests
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// loads saved state for a partial download, returning the validator if it matches this download
+func (d *repoDownload) loadState() string {
+	b, err := os.ReadFile(d.statePath)
+	if err != nil {
+		return ""
+	}
+	var st repoDownloadState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return ""
+	}
+	if st.DID != d.DID.String() || st.Since != d.Since {
+		return ""
+	}
+	return st.Validator
+}
+
+func (d *repoDownload) saveState() error {
+	if d.statePath == "" {
+		return nil
+	}
+	if d.validator == "" {
+		os.Remove(d.statePath)
+		return nil
+	}
+	b, err := json.Marshal(repoDownloadState{DID: d.DID.String(), Since: d.Since, Validator: d.validator})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.statePath, b, 0666)
+}
+
+// empties the file, if 'w' is one, for restarting a download from the beginning
+func truncateDownload(w io.Writer) error {
+	f, ok := w.(*os.File)
+	if !ok {
+		return fmt.Errorf("%w: can not resume download", errRepoDownloadFatal)
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// downloads to a file path. partial data is kept at '<path>.partial' (with state in '<path>.partial.json'), and resumed from on later runs
+func (d *repoDownload) ToFile(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("file already exists: %s", path)
+	}
+	partialPath := path + ".partial"
+	d.statePath = partialPath + ".json"
+	f, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		d.validator = d.loadState()
+		if d.validator == "" {
+			// can't tell if the partial data is from the same version of the repo (or even the same account)
+			fmt.Fprintln(os.Stderr, "partial download can not be safely resumed; restarting from beginning")
+			if err := truncateDownload(f); err != nil {
+				return err
+			}
+			offset = 0
+		} else {
+			fmt.Fprintf(os.Stderr, "resuming partial download (%s)\n", formatByteSize(offset))
+		}
+	}
+
+	prog := newProgressCounter("downloaded", 0)
+	prog.Reset(offset)
+	backoff := 2 * time.Second
+	for attempt := 0; ; attempt++ {
+		offset, err = d.attempt(ctx, f, offset, prog)
+		if err == nil {
+			break
+		}
+		if errors.Is(err, errRepoDownloadFatal) || ctx.Err() != nil || attempt >= d.Retries {
+			prog.Done()
+			return fmt.Errorf("%w (partial download kept at %s)", err, partialPath)
+		}
+		prog.Done()
+		fmt.Fprintf(os.Stderr, "download interrupted (%s); retrying in %s\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+	prog.Done()
+
+	// check that the resulting file is complete and consistent, which is important if it was resumed
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := d.checkCAR(f); err != nil {
+		f.Close()
+		os.Remove(partialPath)
+		os.Remove(d.statePath)
+		return fmt.Errorf("downloaded CAR file is invalid (removed partial download): %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	os.Remove(d.statePath)
+	return os.Rename(partialPath, path)
+}
+
+// Checks a downloaded CAR file. Block hashes are always verified; full exports must also contain a commit and the complete repo tree, so that a file spliced together from different versions of the repo is detected.
+func (d *repoDownload) checkCAR(f io.ReadSeeker) error {
+	if d.Since != "" {
+		_, err := iterCARBlocks(bufio.NewReader(f), func(_ cid.Cid, _ []byte) error { return nil })
+		return err
+	}
+	return checkRepoCAR(f)
+}
+
+// downloads to stdout. retries are only possible if nothing has been written yet
+func (d *repoDownload) ToWriter(ctx context.Context, w io.Writer) error {
+	bw := &countingWriter{W: w}
+	prog := newProgressCounter("downloaded", 0)
+	backoff := 2 * time.Second
+	for attempt := 0; ; attempt++ {
+		_, err := d.attempt(ctx, bw, 0, prog)
+		if err == nil {
+			prog.Done()
+			return nil
+		}
+		if errors.Is(err, errRepoDownloadFatal) || ctx.Err() != nil || attempt >= d.Retries || bw.N > 0 {
+			prog.Done()
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "download failed (%s); retrying in %s\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+type countingWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.W.Write(b)
+	cw.N += int64(n)
+	return n, err
+}
+
+// makes a single download request, starting at offset if possible. returns the new offset. if 'w' is a file, it is truncated if the download can not be resumed
+func (d *repoDownload) attempt(ctx context.Context, w io.Writer, offset int64, prog *progressCounter) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// zero means no idle timeout
+	idle := d.IdleTimeout
+	if idle <= 0 {
+		idle = time.Duration(math.MaxInt64)
+	}
+	timer := time.AfterFunc(idle, cancel)
+	defer timer.Stop()
+
+	req := atclient.NewAPIRequest(atclient.MethodQuery, syntax.NSID("com.atproto.sync.getRepo"), nil)
+	req.Headers.Set("Accept", "application/vnd.ipld.car")
+	req.QueryParams.Set("did", d.DID.String())
+	if d.Since != "" {
+		req.QueryParams.Set("since", d.Since)
+	}
+	if offset > 0 && d.validator == "" {
+		// without a validator, a resumed download could be a mix of two different versions of the repo
+		if err := truncateDownload(w); err != nil {
+			return offset, err
+		}
+		fmt.Fprintln(os.Stderr, "server does not support resuming downloads; restarting from beginning")
+		offset = 0
+	}
+	if offset > 0 {
+		// if the repo has changed, the server responds with the full current version instead
+		req.Headers.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Headers.Set("If-Range", d.validator)
+	}
+	resp, err := d.Client.Do(ctx, req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		if offset == 0 || responseValidator(resp) != d.validator {
+			// unexpected range response (eg, server ignored 'If-Range'); start over with a full request
+			if err := truncateDownload(w); err != nil {
+				return offset, err
+			}
+			d.validator = ""
+			prog.Reset(0)
+			return 0, fmt.Errorf("repo changed during download")
+		}
+		if f, ok := w.(*os.File); ok {
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return offset, err
+			}
+		}
+		prog.Total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if offset > 0 {
+			// repo changed since the partial download, or server does not support range requests; start over
+			if err := truncateDownload(w); err != nil {
+				return offset, err
+			}
+			fmt.Fprintln(os.Stderr, "can not resume download; restarting from beginning")
+			offset = 0
+		}
+		d.validator = responseValidator(resp)
+		if err := d.saveState(); err != nil {
+			return offset, fmt.Errorf("%w: %w", errRepoDownloadFatal, err)
+		}
+		prog.Reset(0)
+		prog.Total = max(resp.ContentLength, 0)
+	default:
+		var eb atclient.ErrorBody
+		var apiErr error = &atclient.APIError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(&eb); err == nil {
+			apiErr = eb.APIError(resp.StatusCode)
+		}
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return offset, apiErr
+		}
+		return offset, fmt.Errorf("%w: %w", errRepoDownloadFatal, apiErr)
+	}
+
+	body := &idleTimeoutReader{R: resp.Body, Timer: timer, Idle: idle}
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return offset, fmt.Errorf("%w: %w", errRepoDownloadFatal, werr)
+			}
+			offset += int64(n)
+			prog.Add(n)
+		}
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return offset, fmt.Errorf("no data received for %s", d.IdleTimeout)
+			}
+			return offset, err
+		}
+	}
+}
+
+// parses the total size from a 'Content-Range' header, eg "bytes 100-199/1000". returns zero if unknown
+func contentRangeTotal(h string) int64 {
+	_, total, ok := strings.Cut(h, "/")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Uploads a repo CAR file (com.atproto.repo.importRepo) as a stream from disk
+func uploadRepoCAR(ctx context.Context, c *atclient.APIClient, carPath string) error {
+	f, err := os.Open(carPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	prog := newProgressCounter("uploaded", info.Size())
+	req := atclient.NewAPIRequest(atclient.MethodProcedure, syntax.NSID("com.atproto.repo.importRepo"), &progressReader{R: f, P: prog})
+	req.Headers.Set("Content-Type", "application/vnd.ipld.car")
+	httpReq, err := req.HTTPRequest(ctx, c.Host, c.Headers)
+	if err != nil {
+		return err
+	}
+	// set length explicitly, so the body is not sent with chunked encoding
+	httpReq.ContentLength = info.Size()
+	// the request is re-sent from the start if auth needs to be refreshed
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		prog.Reset(0)
+		return io.NopCloser(&progressReader{R: f, P: prog}), nil
+	}
+
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	var resp *http.Response
+	if c.Auth != nil {
+		resp, err = c.Auth.DoWithAuth(c.Client, httpReq, req.Endpoint)
+	} else {
+		resp, err = c.Client.Do(httpReq)
+	}
+	prog.Done()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		var eb atclient.ErrorBody
+		if err := json.NewDecoder(resp.Body).Decode(&eb); err != nil {
+			return &atclient.APIError{StatusCode: resp.StatusCode}
+		}
+		return eb.APIError(resp.StatusCode)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
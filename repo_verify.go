@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/atcrypto"
+	"github.com/bluesky-social/indigo/atproto/atdata"
+	"github.com/bluesky-social/indigo/atproto/repo/mst"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/ipfs/go-cid"
+	"github.com/urfave/cli/v3"
+)
+
+var ErrRepoVerifyFailed = errors.New("repo verification failed")
+
+var cmdRepoVerify = &cli.Command{
+	Name:        "verify",
+	Usage:       "verify commit signature, MST structure, and blocks in CAR file",
+	Description: "Checks that every block hashes to its CID, the commit is well-formed and signed by the account's current atproto signing key (or '--key'), every MST node is correctly ordered, at the correct depth, and canonically encoded, and every record block is present and valid.\nAlso reports any missing blocks, and extra blocks which are not part of the repo tree.",
+	ArgsUsage:   `<car-file>`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "key",
+			Usage: "public key to verify commit signature against (instead of resolving the account's current key)",
+		},
+	},
+	Action: runRepoVerify,
+}
+
+// walks a repo MST, collecting problems instead of failing at the first one
+type repoVerifier struct {
+	Blocks *carBlocks
+
+	reachable map[cid.Cid]bool
+	missing   []cid.Cid
+	problems  []string
+	invalid   []string
+	lastKey   []byte
+	nodes     int
+	records   int
+}
+
+func (v *repoVerifier) problem(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// returns block data, recording it as reachable (or missing)
+func (v *repoVerifier) block(c cid.Cid) ([]byte, bool) {
+	if v.reachable[c] {
+		b, ok := v.Blocks.Blocks[c]
+		return b, ok
+	}
+	v.reachable[c] = true
+	b, ok := v.Blocks.Blocks[c]
+	if !ok {
+		v.missing = append(v.missing, c)
+	}
+	return b, ok
+}
+
+// checks an MST node and its subtrees. height is the expected layer of this node, or -1 for the root
+func (v *repoVerifier) walkNode(c cid.Cid, height int) {
+	b, ok := v.block(c)
+	if !ok {
+		return
+	}
+	v.nodes++
+	if c.Prefix().Codec != cid.DagCBOR {
+		v.problem("MST node %s: not a DAG-CBOR CID", c)
+	}
+	nd, err := mst.NodeDataFromCBOR(bytes.NewReader(b))
+	if err != nil {
+		v.problem("MST node %s: invalid encoding: %s", c, err)
+		return
+	}
+	if reencoded, _, err := nd.Bytes(); err != nil || !bytes.Equal(reencoded, b) {
+		v.problem("MST node %s: not canonically encoded", c)
+	}
+	if len(nd.Entries) == 0 {
+		// nodes with only a child pointer are allowed, except at the top of the tree. fully empty nodes are only allowed for an empty repo
+		switch {
+		case nd.Left == nil && height >= 0:
+			v.problem("MST node %s: empty node within tree", c)
+		case nd.Left != nil && height < 0:
+			v.problem("MST node %s: top of tree is just a pointer to child", c)
+		case nd.Left != nil:
+			v.walkChild(c, *nd.Left, height)
+		}
+		return
+	}
+
+	keys, err := decodeNodeKeys(nd)
+	if err != nil {
+		v.problem("MST node %s: %s", c, err)
+		return
+	}
+	for i, e := range nd.Entries {
+		prev := []byte{}
+		if i > 0 {
+			prev = keys[i-1]
+		}
+		if int(e.PrefixLen) != mst.CountPrefixLen(prev, keys[i]) {
+			v.problem("MST node %s: key prefix is not maximally compressed", c)
+		}
+	}
+
+	nodeHeight := mst.HeightForKey(keys[0])
+	if height >= 0 && nodeHeight != height {
+		v.problem("MST node %s: at wrong depth (layer %d, expected %d)", c, nodeHeight, height)
+	}
+	for _, k := range keys {
+		if mst.HeightForKey(k) != nodeHeight {
+			v.problem("MST node %s: key at wrong depth: %s", c, k)
+		}
+	}
+
+	if nd.Left != nil {
+		v.walkChild(c, *nd.Left, nodeHeight)
+	}
+	for i, e := range nd.Entries {
+		v.checkRecord(keys[i], e.Value)
+		if e.Right != nil {
+			v.walkChild(c, *e.Right, nodeHeight)
+		}
+	}
+}
+
+func (v *repoVerifier) walkChild(parent, child cid.Cid, parentHeight int) {
+	if parentHeight == 0 {
+		v.problem("MST node %s: has child below lowest layer", parent)
+		return
+	}
+	v.walkNode(child, parentHeight-1)
+}
+
+// checks key ordering (in-order over the whole tree) and the record block
+func (v *repoVerifier) checkRecord(key []byte, c cid.Cid) {
+	if v.lastKey != nil && bytes.Compare(key, v.lastKey) <= 0 {
+		v.problem("MST key out of order or duplicated: %s", key)
+	}
+	v.lastKey = key
+	if _, _, err := syntax.ParseRepoPath(string(key)); err != nil {
+		v.problem("MST key is not a valid repo path: %s", key)
+	}
+
+	b, ok := v.block(c)
+	if !ok {
+		return
+	}
+	v.records++
+	if _, err := atdata.UnmarshalCBOR(b); err != nil {
+		v.invalid = append(v.invalid, fmt.Sprintf("%s (%s)", key, err))
+	}
+}
+
+// formats a list of items for a report line, truncating long lists
+func summarizeList(items []string) string {
+	const maxItems = 5
+	if len(items) <= maxItems {
+		return strings.Join(items, "; ")
+	}
+	return strings.Join(items[:maxItems], "; ") + fmt.Sprintf("; and %d more", len(items)-maxItems)
+}
+
+func runRepoVerify(ctx context.Context, cmd *cli.Command) error {
+	carPath := cmd.Args().First()
+	if carPath == "" {
+		return fmt.Errorf("need to provide path to CAR file as argument")
+	}
+	fi, err := os.Open(carPath)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	c := checkReport{}
+	defer c.print()
+
+	cb, err := readCARBlocks(bufio.NewReader(fi))
+	if err != nil {
+		c.add("blocks", checkFail, "%s", err)
+		return ErrRepoVerifyFailed
+	}
+	c.add("blocks", checkPass, "%d blocks, all hashes match CIDs", len(cb.Order))
+	if len(cb.Roots) != 1 {
+		c.add("car-roots", checkWarn, "expected a single root, found %d", len(cb.Roots))
+	}
+
+	commit, commitCID, err := cb.Commit()
+	if err != nil {
+		c.add("commit", checkFail, "%s", err)
+		return ErrRepoVerifyFailed
+	}
+	c.add("commit", checkPass, "%s (rev %s, DID %s)", commitCID, commit.Rev, commit.DID)
+
+	var pub atcrypto.PublicKey
+	if cmd.String("key") != "" {
+		pk, err := parseKeyAny(cmd.String("key"), "")
+		if err == nil {
+			pub, err = pk.PublicKey()
+		}
+		if err != nil {
+			c.add("signature", checkFail, "invalid '--key': %s", err)
+		}
+	} else {
+		ident, err := resolveIdentVerify(ctx, cmd, commit.DID)
+		if err == nil {
+			pub, err = ident.PublicKey()
+		}
+		if err != nil {
+			c.add("signature", checkFail, "could not resolve current signing key: %s", err)
+		}
+	}
+	if pub != nil {
+		if err := commit.VerifySignature(pub); err != nil {
+			c.add("signature", checkFail, "%s", err)
+		} else {
+			c.add("signature", checkPass, "valid signature from %s", pub.DIDKey())
+		}
+	}
+
+	v := repoVerifier{
+		Blocks:    cb,
+		reachable: map[cid.Cid]bool{*commitCID: true},
+	}
+	v.walkNode(commit.Data, -1)
+
+	if len(v.problems) > 0 {
+		c.add("mst", checkFail, "%d problems: %s", len(v.problems), summarizeList(v.problems))
+	} else {
+		c.add("mst", checkPass, "%d nodes, correctly ordered, layered, and encoded", v.nodes)
+	}
+	if len(v.invalid) > 0 {
+		c.add("records", checkFail, "%d invalid records: %s", len(v.invalid), summarizeList(v.invalid))
+	} else {
+		c.add("records", checkPass, "%d records", v.records)
+	}
+	if len(v.missing) > 0 {
+		missing := make([]string, len(v.missing))
+		for i, m := range v.missing {
+			missing[i] = m.String()
+		}
+		c.add("missing-blocks", checkFail, "%d blocks missing: %s", len(missing), summarizeList(missing))
+	} else {
+		c.add("missing-blocks", checkPass, "none")
+	}
+	extra := []string{}
+	for _, blk := range cb.Order {
+		if !v.reachable[blk] {
+			extra = append(extra, blk.String())
+		}
+	}
+	if len(extra) > 0 {
+		c.add("extra-blocks", checkWarn, "%d blocks not part of repo tree: %s", len(extra), summarizeList(extra))
+	} else {
+		c.add("extra-blocks", checkPass, "none")
+	}
+
+	if c.failed() {
+		return ErrRepoVerifyFailed
+	}
+	return nil
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
@@ -15,35 +21,71 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/multiformats/go-multihash"
 	"github.com/urfave/cli/v3"
+	"github.com/yudai/gojsondiff"
+	"github.com/yudai/gojsondiff/formatter"
 )
 
-// helper to configure identity directory with PLC host (from env var) and user agent
-func configDirectory(plcHost string) identity.Directory {
-	dir := identity.DefaultDirectory()
-
-	cdir, ok := dir.(*identity.CacheDirectory)
-	if ok {
-		bdir, ok := cdir.Inner.(*identity.BaseDirectory)
-		if ok {
-			bdir.UserAgent = userAgentString()
-			if plcHost != "" {
-				bdir.PLCURL = plcHost
-			}
-		}
+// helper to configure identity directory, with PLC host (from env var), user agent, and the global handle resolution flags ('--handle-method', '--dns-server', '--authoritative-dns').
+//
+// lookups are persisted to the on-disk identity cache, unless disabled with '--no-cache', using a non-default PLC host, or using non-default handle resolution
+func configDirectory(cmd *cli.Command) identity.Directory {
+	bdir := configBaseDirectory(cmd)
+	var inner identity.Directory = bdir
+	if m := cmd.String("handle-method"); m != "" && m != "any" {
+		inner = &handleMethodDirectory{Base: bdir, Method: m}
+	}
+	dir := identity.NewCacheDirectory(inner, 250_000, time.Hour*24, time.Minute*2, time.Minute*5)
+
+	plcHost := cmd.String("plc-host")
+	if cmd.Bool("no-cache") || (plcHost != "" && plcHost != identity.DefaultPLCURL) || customHandleResolution(cmd) {
+		return dir
+	}
+	cacheDir, err := identityCacheDir()
+	if err != nil {
+		slog.Warn("identity cache not available", "err", err)
+		return dir
+	}
+	return &DiskCacheDirectory{
+		Inner: dir,
+		Dir:   cacheDir,
+		TTL:   identityCacheTTL,
+	}
+}
+
+// like configDirectory, but never reads identities from the on-disk cache (fresh lookups are still written to it). used when verifying signatures, so a recent signing key rotation is not missed
+func configVerifyDirectory(cmd *cli.Command) identity.Directory {
+	dir := configDirectory(cmd)
+	if dcd, ok := dir.(*DiskCacheDirectory); ok {
+		dcd.Refresh = true
 	}
 	return dir
 }
 
+// true if any of the global handle resolution flags are set to non-default values. results resolved this way are not written to (or read from) the on-disk cache
+func customHandleResolution(cmd *cli.Command) bool {
+	m := cmd.String("handle-method")
+	return (m != "" && m != "any") || cmd.String("dns-server") != "" || !cmd.Bool("authoritative-dns")
+}
+
 func resolveIdent(ctx context.Context, cmd *cli.Command, arg string) (*identity.Identity, error) {
 	id, err := syntax.ParseAtIdentifier(arg)
 	if err != nil {
 		return nil, err
 	}
 
-	dir := configDirectory(cmd.String("plc-host"))
+	dir := configDirectory(cmd)
 	return dir.Lookup(ctx, id)
 }
 
+// like resolveIdent, but bypasses the on-disk identity cache; for checking signatures against the current signing key
+func resolveIdentVerify(ctx context.Context, cmd *cli.Command, arg string) (*identity.Identity, error) {
+	id, err := syntax.ParseAtIdentifier(arg)
+	if err != nil {
+		return nil, err
+	}
+	return configVerifyDirectory(cmd).Lookup(ctx, id)
+}
+
 func resolveToDID(ctx context.Context, cmd *cli.Command, s string) (syntax.DID, error) {
 	atid, err := syntax.ParseAtIdentifier(s)
 	if err != nil {
@@ -54,11 +96,137 @@ func resolveToDID(ctx context.Context, cmd *cli.Command, s string) (syntax.DID,
 		return did, nil
 	}
 	hdl, _ := atid.AsHandle()
-	bdir := identity.BaseDirectory{
-		PLCURL:    cmd.String("plc-host"),
-		UserAgent: userAgentString(),
+	return resolveHandle(ctx, cmd, configBaseDirectory(cmd), hdl)
+}
+
+// helper to configure a non-caching identity directory, including the global handle resolution flags ('--dns-server', '--authoritative-dns'). otherwise uses the SDK default settings (HTTP transport, DNS timeouts, domains skipped for DNS resolution)
+func configBaseDirectory(cmd *cli.Command) *identity.BaseDirectory {
+	bdir := &identity.BaseDirectory{
+		PLCURL: identity.DefaultPLCURL,
+		HTTPClient: http.Client{
+			Timeout: time.Second * 10,
+		},
+		SkipDNSDomainSuffixes: []string{".bsky.social"},
+	}
+	if cdir, ok := identity.DefaultDirectory().(*identity.CacheDirectory); ok {
+		if b, ok := cdir.Inner.(*identity.BaseDirectory); ok {
+			bdir = b
+		}
+	}
+	bdir.UserAgent = userAgentString()
+	if plcHost := cmd.String("plc-host"); plcHost != "" {
+		bdir.PLCURL = plcHost
+	}
+	bdir.TryAuthoritativeDNS = cmd.Bool("authoritative-dns")
+	if ns := cmd.String("dns-server"); ns != "" {
+		if _, _, err := net.SplitHostPort(ns); err != nil {
+			ns = net.JoinHostPort(ns, "53")
+		}
+		bdir.Resolver = net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: time.Second * 5}
+				return d.DialContext(ctx, network, ns)
+			},
+		}
+	}
+	return bdir
+}
+
+// resolves a handle to a DID using the method selected with '--handle-method'. does not bi-directionally verify the handle
+func resolveHandle(ctx context.Context, cmd *cli.Command, bdir *identity.BaseDirectory, handle syntax.Handle) (syntax.DID, error) {
+	return resolveHandleMethod(ctx, bdir, cmd.String("handle-method"), handle)
+}
+
+func resolveHandleMethod(ctx context.Context, bdir *identity.BaseDirectory, method string, handle syntax.Handle) (syntax.DID, error) {
+	handle = handle.Normalize()
+	switch method {
+	case "", "any":
+		return bdir.ResolveHandle(ctx, handle)
+	case "dns":
+		// same as the DNS part of the default method: the authoritative nameserver is only tried if normal DNS finds no record
+		did, err := bdir.ResolveHandleDNS(ctx, handle)
+		if errors.Is(err, identity.ErrHandleNotFound) && bdir.TryAuthoritativeDNS {
+			return bdir.ResolveHandleDNSAuthoritative(ctx, handle)
+		}
+		return did, err
+	case "http":
+		return bdir.ResolveHandleWellKnown(ctx, handle)
+	default:
+		return "", fmt.Errorf("unknown handle resolution method: %s", method)
 	}
-	return bdir.ResolveHandle(ctx, hdl)
+}
+
+// identity directory which resolves handles with a single method (for '--handle-method'), instead of the default DNS-then-HTTP. otherwise the same as identity.BaseDirectory
+type handleMethodDirectory struct {
+	Base   *identity.BaseDirectory
+	Method string
+}
+
+var _ identity.Directory = (*handleMethodDirectory)(nil)
+
+func (d *handleMethodDirectory) LookupHandle(ctx context.Context, h syntax.Handle) (*identity.Identity, error) {
+	h = h.Normalize()
+	did, err := resolveHandleMethod(ctx, d.Base, d.Method, h)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := d.Base.ResolveDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	ident := identity.ParseIdentity(doc)
+	declared, err := ident.DeclaredHandle()
+	if err != nil {
+		return nil, fmt.Errorf("could not verify handle/DID match: %w", err)
+	}
+	if declared != h {
+		return nil, fmt.Errorf("%w: %s != %s", identity.ErrHandleMismatch, declared, h)
+	}
+	ident.Handle = declared
+	return &ident, nil
+}
+
+func (d *handleMethodDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	doc, err := d.Base.ResolveDID(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	ident := identity.ParseIdentity(doc)
+	declared, err := ident.DeclaredHandle()
+	if errors.Is(err, identity.ErrHandleNotDeclared) {
+		ident.Handle = syntax.HandleInvalid
+	} else if err != nil {
+		return nil, fmt.Errorf("could not parse handle from DID document: %w", err)
+	} else {
+		resolvedDID, err := resolveHandleMethod(ctx, d.Base, d.Method, declared)
+		if err != nil {
+			if errors.Is(err, identity.ErrHandleNotFound) || errors.Is(err, identity.ErrHandleResolutionFailed) {
+				ident.Handle = syntax.HandleInvalid
+			} else {
+				return nil, err
+			}
+		} else if resolvedDID != did {
+			ident.Handle = syntax.HandleInvalid
+		} else {
+			ident.Handle = declared
+		}
+	}
+	return &ident, nil
+}
+
+func (d *handleMethodDirectory) Lookup(ctx context.Context, atid syntax.AtIdentifier) (*identity.Identity, error) {
+	if handle, err := atid.AsHandle(); err == nil {
+		return d.LookupHandle(ctx, handle)
+	}
+	if did, err := atid.AsDID(); err == nil {
+		return d.LookupDID(ctx, did)
+	}
+	return nil, fmt.Errorf("at-identifier neither a Handle nor a DID")
+}
+
+func (d *handleMethodDirectory) Purge(ctx context.Context, atid syntax.AtIdentifier) error {
+	return nil
 }
 
 const stdIOPath = "-"
@@ -135,3 +303,32 @@ func computeRawCID(b []byte) (*cid.Cid, error) {
 	}
 	return &c, err
 }
+
+// computes a human-readable (colored, ASCII) diff between two JSON objects
+func formatJSONDiff(oldJSON, newJSON []byte) (string, error) {
+	var outJSON map[string]any
+	differ := gojsondiff.New()
+	d, err := differ.Compare(oldJSON, newJSON)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(oldJSON, &outJSON); err != nil {
+		return "", err
+	}
+	config := formatter.AsciiFormatterConfig{
+		//ShowArrayIndex: true,
+		Coloring: true,
+	}
+	return formatter.NewAsciiFormatter(outJSON, config).Format(d)
+}
+
+// asks a yes/no question on the terminal. defaults to "no"
+func confirmPrompt(question string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}